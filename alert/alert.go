@@ -0,0 +1,405 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package alert evaluates declarative alerting rules against readings,
+// with hysteresis, minimum durations, re-notification and acknowledgement.
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/rate"
+)
+
+// Kind is the kind of condition a rule checks.
+type Kind string
+
+const (
+	// Above fires while a probe's temperature is above the threshold.
+	Above Kind = "above"
+	// Below fires while a probe's temperature is below the threshold.
+	Below Kind = "below"
+	// Outside fires while a probe's temperature is outside the range from Low to High.
+	Outside Kind = "outside"
+	// Rising fires while a probe's temperature rises faster than the threshold, in celsius per minute.
+	Rising Kind = "rising"
+	// Falling fires while a probe's temperature falls faster than the threshold, in celsius per minute.
+	Falling Kind = "falling"
+	// Stale fires when no reading has been received for the rule's MinDuration.
+	Stale Kind = "stale"
+	// BatteryLow fires while the battery level is below the threshold, in percent.
+	BatteryLow Kind = "battery_low"
+	// Unplugged fires while a probe is unplugged.
+	Unplugged Kind = "unplugged"
+)
+
+// Rule is an alerting rule.
+type Rule struct {
+	// Name identifies the rule, and must be unique within an engine.
+	Name string
+	// Kind is the condition to check.
+	Kind Kind
+	// Probe is the index of the probe to watch. It is ignored by Stale and BatteryLow rules.
+	Probe int
+	// Threshold is the temperature, rate of change or battery level at which the rule fires.
+	Threshold float64
+	// Low and High bound the acceptable range of an Outside rule.
+	Low  float64
+	High float64
+	// Hysteresis is how far back past the threshold the value must return before the alert resolves.
+	Hysteresis float64
+	// MinDuration is how long the condition must hold before the alert fires.
+	// For Stale rules, it is how long without a reading counts as stale.
+	MinDuration time.Duration
+	// Renotify, if set, is how often an unacknowledged alert is re-notified while it remains active.
+	Renotify time.Duration
+}
+
+// Validate checks a rule is well-formed.
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("rule has no name")
+	}
+	switch r.Kind {
+	case Above, Below, Rising, Falling, BatteryLow, Unplugged:
+	case Outside:
+		if r.Low >= r.High {
+			return fmt.Errorf("rule %q: low must be below high", r.Name)
+		}
+	case Stale:
+		if r.MinDuration <= 0 {
+			return fmt.Errorf("rule %q: stale rules need a minimum duration", r.Name)
+		}
+	default:
+		return fmt.Errorf("rule %q: unknown kind %q", r.Name, r.Kind)
+	}
+	if r.Probe < 0 {
+		return fmt.Errorf("rule %q: invalid probe %d", r.Name, r.Probe)
+	}
+	if r.Hysteresis < 0 {
+		return fmt.Errorf("rule %q: hysteresis must not be negative", r.Name)
+	}
+	return nil
+}
+
+// Configuration configures an Engine.
+type Configuration struct {
+	// Rules are the rules to evaluate.
+	Rules []Rule
+	// RateWindow is the period over which rates of change are measured for Rising and Falling rules.
+	RateWindow time.Duration
+	// Suppressor, if set, pauses temperature and rate rules while it reports readings as suppressed,
+	// e.g. while the cooker's lid is open.
+	Suppressor ibbq.Suppressor
+}
+
+// DefaultConfiguration is a somewhat sane default, with no rules.
+var DefaultConfiguration = Configuration{
+	RateWindow: 5 * time.Minute,
+}
+
+// EventType is the type of an alert event.
+type EventType int
+
+const (
+	// Fired is reported when an alert fires.
+	Fired EventType = iota
+	// Renotified is reported periodically while an unacknowledged alert remains active.
+	Renotified
+	// Resolved is reported when an alert's condition no longer holds.
+	Resolved
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Fired:
+		return "fired"
+	case Renotified:
+		return "renotified"
+	case Resolved:
+		return "resolved"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Alert is an active, or just resolved, alert.
+type Alert struct {
+	Rule Rule
+	// Since is when the alert fired.
+	Since time.Time
+	// Value is the most recent value of the watched temperature, rate of change or battery level,
+	// or for Stale rules the number of seconds since the last reading.
+	Value float64
+	// Acknowledged is set once the alert has been acknowledged, which stops re-notification.
+	Acknowledged bool
+	// Notifications counts the events reported for the alert.
+	Notifications int
+}
+
+// Event reports an alert firing, being re-notified or resolving.
+type Event struct {
+	Type  EventType
+	Alert Alert
+	// Time is when the event occurred.
+	Time time.Time
+}
+
+// Handler is a callback for alert events.
+type Handler func(Event)
+
+// Handlers combines several handlers into one, which calls each in turn.
+func Handlers(handlers ...Handler) Handler {
+	return func(event Event) {
+		for _, handler := range handlers {
+			if handler != nil {
+				handler(event)
+			}
+		}
+	}
+}
+
+type ruleState struct {
+	pendingSince time.Time
+	active       bool
+	alert        Alert
+	lastNotified time.Time
+}
+
+// Engine evaluates rules against readings and battery levels. It is safe for concurrent use.
+type Engine struct {
+	mu          sync.Mutex
+	config      Configuration
+	handler     Handler
+	rates       *rate.Calculator
+	states      []ruleState
+	started     time.Time
+	lastReading time.Time
+	reading     ibbq.Reading
+	battery     int
+	hasBattery  bool
+}
+
+// NewEngine creates an engine. The handler, which may be nil, is called with each alert event.
+func NewEngine(config Configuration, handler Handler) (*Engine, error) {
+	names := map[string]bool{}
+	for _, rule := range config.Rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	config.Rules = append([]Rule(nil), config.Rules...)
+	return &Engine{
+		config:  config,
+		handler: handler,
+		rates:   rate.NewCalculator(rate.Configuration{Window: config.RateWindow}, nil),
+		states:  make([]ruleState, len(config.Rules)),
+		started: time.Now(),
+	}, nil
+}
+
+// Update feeds a reading to the engine. It is meant to be called from a reading handler.
+func (e *Engine) Update(reading ibbq.Reading) {
+	e.rates.Update(reading)
+	e.mu.Lock()
+	e.reading = reading
+	e.lastReading = reading.Time
+	events := e.evaluate(reading.Time)
+	handler := e.handler
+	e.mu.Unlock()
+	notify(handler, events)
+}
+
+// UpdateBattery feeds a battery level, in percent, to the engine.
+// It has the signature of an ibbq.BatteryLevelReceivedHandler.
+func (e *Engine) UpdateBattery(percent int) {
+	e.mu.Lock()
+	e.battery = percent
+	e.hasBattery = true
+	events := e.evaluate(time.Now())
+	handler := e.handler
+	e.mu.Unlock()
+	notify(handler, events)
+}
+
+// Check evaluates the rules at the given time, without a new reading.
+// It needs to be called periodically for Stale rules and re-notifications to work when readings stop.
+func (e *Engine) Check(t time.Time) {
+	e.mu.Lock()
+	events := e.evaluate(t)
+	handler := e.handler
+	e.mu.Unlock()
+	notify(handler, events)
+}
+
+// DefaultCheckInterval is the interval at which Run calls Check when it is given one which isn't positive.
+const DefaultCheckInterval = 10 * time.Second
+
+// Run calls Check at the given interval until the context is done.
+// An interval which isn't positive is replaced with DefaultCheckInterval.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			e.Check(t)
+		}
+	}
+}
+
+// Acknowledge acknowledges the named rule's active alert, which stops it being re-notified until it resolves.
+// It reports whether there was an active alert to acknowledge.
+func (e *Engine) Acknowledge(name string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, rule := range e.config.Rules {
+		if rule.Name == name && e.states[i].active {
+			e.states[i].alert.Acknowledged = true
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns the alerts which are currently active.
+func (e *Engine) Active() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var alerts []Alert
+	for _, state := range e.states {
+		if state.active {
+			alerts = append(alerts, state.alert)
+		}
+	}
+	return alerts
+}
+
+func notify(handler Handler, events []Event) {
+	if handler == nil {
+		return
+	}
+	for _, event := range events {
+		handler(event)
+	}
+}
+
+func (e *Engine) evaluate(t time.Time) []Event {
+	var events []Event
+	suppressed := e.config.Suppressor != nil && e.config.Suppressor.Suppressed()
+	for i, rule := range e.config.Rules {
+		state := &e.states[i]
+		if suppressed && rule.Kind != Stale && rule.Kind != BatteryLow && rule.Kind != Unplugged {
+			state.pendingSince = time.Time{}
+			continue
+		}
+		value, firing, clear, ok := e.condition(rule, t)
+		if !ok {
+			continue
+		}
+		if state.active {
+			state.alert.Value = value
+		}
+		switch {
+		case !state.active && firing:
+			if state.pendingSince.IsZero() {
+				state.pendingSince = t
+			}
+			if rule.Kind == Stale || t.Sub(state.pendingSince) >= rule.MinDuration {
+				state.active = true
+				state.alert = Alert{Rule: rule, Since: t, Value: value, Notifications: 1}
+				state.lastNotified = t
+				events = append(events, Event{Type: Fired, Alert: state.alert, Time: t})
+			}
+		case !state.active:
+			state.pendingSince = time.Time{}
+		case clear:
+			state.active = false
+			state.pendingSince = time.Time{}
+			state.alert.Notifications++
+			events = append(events, Event{Type: Resolved, Alert: state.alert, Time: t})
+		case rule.Renotify > 0 && !state.alert.Acknowledged && t.Sub(state.lastNotified) >= rule.Renotify:
+			state.lastNotified = t
+			state.alert.Notifications++
+			events = append(events, Event{Type: Renotified, Alert: state.alert, Time: t})
+		}
+	}
+	return events
+}
+
+// condition returns the rule's current value, whether the rule should fire, and whether an active alert should resolve.
+// Values between the two are within the rule's hysteresis band. It reports false if there is nothing to evaluate.
+func (e *Engine) condition(rule Rule, t time.Time) (value float64, firing bool, clear bool, ok bool) {
+	switch rule.Kind {
+	case Stale:
+		last := e.lastReading
+		if last.IsZero() {
+			last = e.started
+		}
+		age := t.Sub(last)
+		return age.Seconds(), age >= rule.MinDuration, age < rule.MinDuration, true
+	case BatteryLow:
+		if !e.hasBattery {
+			return 0, false, false, false
+		}
+		value = float64(e.battery)
+		return value, value < rule.Threshold, value >= rule.Threshold+rule.Hysteresis, true
+	case Rising, Falling:
+		if value, ok = e.rates.Rate(rule.Probe); !ok {
+			return 0, false, false, false
+		}
+		speed := value
+		if rule.Kind == Falling {
+			speed = -value
+		}
+		return value, speed > rule.Threshold, speed <= rule.Threshold-rule.Hysteresis, true
+	}
+	if rule.Probe >= len(e.reading.Temperatures) {
+		return 0, false, false, false
+	}
+	value = e.reading.Temperatures[rule.Probe]
+	if rule.Kind == Unplugged {
+		unplugged := !ibbq.ProbeConnected(value)
+		return value, unplugged, !unplugged, true
+	}
+	if !ibbq.ProbeConnected(value) {
+		return 0, false, false, false
+	}
+	switch rule.Kind {
+	case Above:
+		return value, value > rule.Threshold, value <= rule.Threshold-rule.Hysteresis, true
+	case Below:
+		return value, value < rule.Threshold, value >= rule.Threshold+rule.Hysteresis, true
+	case Outside:
+		firing = value < rule.Low || value > rule.High
+		clear = value >= rule.Low+rule.Hysteresis && value <= rule.High-rule.Hysteresis
+		return value, firing, clear, true
+	}
+	return 0, false, false, false
+}
@@ -0,0 +1,74 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		fires    bool
+	}{
+		{"positive", 10 * time.Millisecond, true},
+		{"zero", 0, false},
+		{"negative", -time.Second, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := make(chan Event, 1)
+			config := DefaultConfiguration
+			config.Rules = []Rule{{Name: "stale", Kind: Stale, MinDuration: time.Millisecond}}
+			engine, err := NewEngine(config, func(event Event) {
+				select {
+				case events <- event:
+				default:
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				engine.Run(ctx, test.interval)
+			}()
+			select {
+			case event := <-events:
+				if !test.fires {
+					t.Errorf("got %v before the default check interval", event)
+				} else if event.Type != Fired || event.Alert.Rule.Name != "stale" {
+					t.Errorf("got %+v, want the stale alert to fire", event)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if test.fires {
+					t.Error("stale alert didn't fire")
+				}
+			}
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Run didn't return when the context was cancelled")
+			}
+		})
+	}
+}
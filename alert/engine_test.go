@@ -0,0 +1,200 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package alert
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+const unplugged = ibbq.UnpluggedTemperature
+
+type suppressor struct {
+	on bool
+}
+
+func (s *suppressor) Suppressed() bool { return s.on }
+
+// step does something to the engine at a time relative to when it was created.
+type step struct {
+	at time.Duration
+	do func(e *Engine, s *suppressor, t time.Time)
+}
+
+func reading(at time.Duration, temperatures ...float64) step {
+	return step{at, func(e *Engine, s *suppressor, t time.Time) {
+		e.Update(ibbq.Reading{Time: t, Temperatures: temperatures})
+	}}
+}
+
+func battery(at time.Duration, percent int) step {
+	return step{at, func(e *Engine, s *suppressor, t time.Time) { e.UpdateBattery(percent) }}
+}
+
+func check(at time.Duration) step {
+	return step{at, func(e *Engine, s *suppressor, t time.Time) { e.Check(t) }}
+}
+
+func acknowledge(at time.Duration, name string) step {
+	return step{at, func(e *Engine, s *suppressor, t time.Time) { e.Acknowledge(name) }}
+}
+
+func suppress(at time.Duration, on bool) step {
+	return step{at, func(e *Engine, s *suppressor, t time.Time) { s.on = on }}
+}
+
+// changing returns readings every 30 seconds of a probe whose temperature changes at the given rate,
+// in celsius per minute, starting from the given temperature.
+func changing(from, to time.Duration, temperature, rate float64) []step {
+	var steps []step
+	for at := from; at <= to; at += 30 * time.Second {
+		steps = append(steps, reading(at, temperature+rate*(at-from).Minutes()))
+	}
+	return steps
+}
+
+func TestEngine(t *testing.T) {
+	s := time.Second
+	tests := []struct {
+		name  string
+		rule  Rule
+		steps []step
+		// want are the events, as "type name value@seconds" with the value rounded
+		want []string
+	}{
+		{"above", Rule{Name: "done", Kind: Above, Threshold: 90, Hysteresis: 2},
+			[]step{reading(0, 85), reading(10*s, 91), reading(20*s, 89), reading(30*s, 88), reading(40*s, 91)},
+			[]string{"fired done 91@10", "resolved done 88@30", "fired done 91@40"}},
+		{"below", Rule{Name: "cold", Kind: Below, Threshold: 100, Hysteresis: 5},
+			[]step{reading(0, 110), reading(10*s, 99), reading(20*s, 103), reading(30*s, 105)},
+			[]string{"fired cold 99@10", "resolved cold 105@30"}},
+		{"outside", Rule{Name: "pit", Kind: Outside, Low: 100, High: 120, Hysteresis: 5},
+			[]step{reading(0, 110), reading(10*s, 125), reading(20*s, 116), reading(30*s, 114), reading(40*s, 95)},
+			[]string{"fired pit 125@10", "resolved pit 114@30", "fired pit 95@40"}},
+		{"min duration", Rule{Name: "done", Kind: Above, Threshold: 90, MinDuration: 30 * s},
+			[]step{reading(0, 91), reading(20*s, 91), reading(25*s, 85), reading(40*s, 91), reading(60*s, 91), reading(70*s, 91)},
+			[]string{"fired done 91@70"}},
+		{"unplugged temperatures are ignored", Rule{Name: "done", Kind: Above, Threshold: 90},
+			[]step{reading(0, 85), reading(10*s, unplugged), reading(20*s, 85)},
+			nil},
+		{"probe missing from readings", Rule{Name: "done", Kind: Above, Probe: 3, Threshold: 90},
+			[]step{reading(0, 95)},
+			nil},
+		{"unplugged", Rule{Name: "pit probe", Kind: Unplugged},
+			[]step{reading(0, 50), reading(10*s, unplugged), reading(20*s, unplugged), reading(30*s, 50)},
+			[]string{"fired pit probe 6553@10", "resolved pit probe 50@30"}},
+		{"stale", Rule{Name: "quiet", Kind: Stale, MinDuration: time.Minute},
+			[]step{reading(0, 50), check(30 * s), check(60 * s), check(90 * s), reading(100*s, 50)},
+			[]string{"fired quiet 60@60", "resolved quiet 0@100"}},
+		{"stale without readings", Rule{Name: "quiet", Kind: Stale, MinDuration: time.Minute},
+			[]step{check(30 * s), check(60 * s)},
+			[]string{"fired quiet 60@60"}},
+		// battery levels are evaluated when they arrive, rather than at the step's time
+		{"battery low", Rule{Name: "battery", Kind: BatteryLow, Threshold: 20, Hysteresis: 5},
+			[]step{check(0), battery(0, 25), battery(0, 15), battery(0, 22), battery(0, 25)},
+			[]string{"fired battery 15@0", "resolved battery 25@0"}},
+		{"rising", Rule{Name: "climbing", Kind: Rising, Threshold: 1},
+			append(changing(0, 2*time.Minute, 100, 2), changing(150*s, 5*time.Minute, 104, 0)...),
+			[]string{"fired climbing 2@60", "resolved climbing 1@180"}},
+		{"falling", Rule{Name: "fire dying", Kind: Falling, Threshold: 1, Hysteresis: 0.5},
+			append(changing(0, 2*time.Minute, 100, -2), changing(150*s, 5*time.Minute, 96, 0)...),
+			[]string{"fired fire dying -2@60", "resolved fire dying -0@210"}},
+		{"falling doesn't fire a rising rule", Rule{Name: "climbing", Kind: Rising, Threshold: 1},
+			changing(0, 2*time.Minute, 100, -2),
+			nil},
+		{"renotify", Rule{Name: "done", Kind: Above, Threshold: 90, Renotify: time.Minute},
+			[]step{reading(0, 91), check(30 * s), check(60 * s), check(90 * s), reading(120*s, 92), reading(130*s, 80)},
+			[]string{"fired done 91@0", "renotified done 91@60", "renotified done 92@120", "resolved done 80@130"}},
+		{"acknowledged", Rule{Name: "done", Kind: Above, Threshold: 90, Renotify: time.Minute},
+			[]step{reading(0, 91), acknowledge(10*s, "done"), check(60 * s), reading(70*s, 80), reading(80*s, 91), check(140 * s)},
+			[]string{"fired done 91@0", "resolved done 80@70", "fired done 91@80", "renotified done 91@140"}},
+		{"suppressed", Rule{Name: "done", Kind: Above, Threshold: 90, MinDuration: 20 * s},
+			[]step{reading(0, 91), suppress(5*s, true), reading(10*s, 91), reading(20*s, 91), suppress(25*s, false), reading(30*s, 91), reading(50*s, 91)},
+			[]string{"fired done 91@50"}},
+		{"stale rules aren't suppressed", Rule{Name: "quiet", Kind: Stale, MinDuration: time.Minute},
+			[]step{suppress(0, true), check(60 * s)},
+			[]string{"fired quiet 60@60"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &suppressor{}
+			var got []string
+			config := Configuration{Rules: []Rule{test.rule}, RateWindow: 2 * time.Minute, Suppressor: s}
+			var e *Engine
+			e, err := NewEngine(config, func(event Event) {
+				got = append(got, fmt.Sprintf("%v %s %.0f@%.0f", event.Type, event.Alert.Rule.Name, event.Alert.Value, event.Time.Sub(e.started).Seconds()))
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, step := range test.steps {
+				step.do(e, s, e.started.Add(step.at))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	config := Configuration{Rules: []Rule{
+		{Name: "done", Kind: Above, Threshold: 90},
+		{Name: "cold", Kind: Below, Threshold: 50},
+	}}
+	e, err := NewEngine(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Update(ibbq.Reading{Time: e.started, Temperatures: []float64{95}})
+	if e.Acknowledge("cold") {
+		t.Error("acknowledged an inactive alert")
+	}
+	if e.Acknowledge("unknown") {
+		t.Error("acknowledged an unknown rule")
+	}
+	if !e.Acknowledge("done") {
+		t.Error("didn't acknowledge an active alert")
+	}
+	active := e.Active()
+	if len(active) != 1 || active[0].Rule.Name != "done" || !active[0].Acknowledged {
+		t.Errorf("got active alerts %+v, want done acknowledged", active)
+	}
+}
+
+func TestNewEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr bool
+	}{
+		{"no rules", nil, false},
+		{"rules", []Rule{{Name: "a", Kind: Above}, {Name: "b", Kind: Below}}, false},
+		{"duplicate names", []Rule{{Name: "a", Kind: Above}, {Name: "a", Kind: Below}}, true},
+		{"invalid rule", []Rule{{Name: "a", Kind: Stale}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewEngine(Configuration{Rules: test.rules}, nil); (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package alert
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// duration is a time.Duration which is written as a string such as "5m" in rules files.
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+// number is a float64 which may be written as an integer in rules files.
+type number float64
+
+func (n *number) UnmarshalText(text []byte) error {
+	f, err := strconv.ParseFloat(string(text), 64)
+	*n = number(f)
+	return err
+}
+
+// fileRule is a rule as written in a rules file. Probes are numbered from 1, as they are on the device.
+type fileRule struct {
+	Name        string   `toml:"name"`
+	Kind        Kind     `toml:"kind"`
+	Probe       int      `toml:"probe"`
+	Threshold   number   `toml:"threshold"`
+	Low         number   `toml:"low"`
+	High        number   `toml:"high"`
+	Hysteresis  number   `toml:"hysteresis"`
+	MinDuration duration `toml:"min_duration"`
+	Renotify    duration `toml:"renotify"`
+}
+
+type rulesFile struct {
+	Rules []fileRule `toml:"rule"`
+}
+
+// ParseRules reads rules in TOML format, e.g.
+//
+//	[[rule]]
+//	name = "brisket done"
+//	kind = "above"
+//	probe = 1
+//	threshold = 93
+//	hysteresis = 1
+//	min_duration = "30s"
+//	renotify = "5m"
+//
+// Probes are numbered from 1, as they are on the device.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	var file rulesFile
+	if _, err := toml.DecodeReader(r, &file); err != nil {
+		return nil, err
+	}
+	rules := make([]Rule, 0, len(file.Rules))
+	for _, fr := range file.Rules {
+		rule := Rule{
+			Name:        fr.Name,
+			Kind:        fr.Kind,
+			Threshold:   float64(fr.Threshold),
+			Low:         float64(fr.Low),
+			High:        float64(fr.High),
+			Hysteresis:  float64(fr.Hysteresis),
+			MinDuration: fr.MinDuration.Duration,
+			Renotify:    fr.Renotify.Duration,
+		}
+		switch fr.Kind {
+		case Stale, BatteryLow:
+		default:
+			if fr.Probe < 1 {
+				return nil, fmt.Errorf("rule %q: probe must be given, numbered from 1", fr.Name)
+			}
+			rule.Probe = fr.Probe - 1
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// LoadRules reads rules from a TOML file. See ParseRules for the format.
+func LoadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseRules(f)
+}
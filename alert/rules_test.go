@@ -0,0 +1,133 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package alert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []Rule
+		wantErr string
+	}{
+		{"empty", "", []Rule{}, ""},
+		{"above", `
+[[rule]]
+name = "brisket done"
+kind = "above"
+probe = 2
+threshold = 93
+hysteresis = 1.5
+min_duration = "30s"
+renotify = "5m"
+`, []Rule{{Name: "brisket done", Kind: Above, Probe: 1, Threshold: 93, Hysteresis: 1.5, MinDuration: 30 * time.Second, Renotify: 5 * time.Minute}}, ""},
+		{"several", `
+[[rule]]
+name = "pit"
+kind = "outside"
+probe = 1
+low = 105
+high = 125
+
+[[rule]]
+name = "quiet"
+kind = "stale"
+min_duration = "2m"
+
+[[rule]]
+name = "battery"
+kind = "battery_low"
+threshold = 20
+
+[[rule]]
+name = "fire dying"
+kind = "falling"
+probe = 1
+threshold = 2
+`, []Rule{
+			{Name: "pit", Kind: Outside, Probe: 0, Low: 105, High: 125},
+			{Name: "quiet", Kind: Stale, MinDuration: 2 * time.Minute},
+			{Name: "battery", Kind: BatteryLow, Threshold: 20},
+			{Name: "fire dying", Kind: Falling, Probe: 0, Threshold: 2},
+		}, ""},
+		{"unknown kind", `
+[[rule]]
+name = "hot"
+kind = "scorching"
+probe = 1
+`, nil, `unknown kind "scorching"`},
+		{"missing probe", `
+[[rule]]
+name = "done"
+kind = "above"
+threshold = 93
+`, nil, "probe must be given"},
+		{"probe numbered from zero", `
+[[rule]]
+name = "done"
+kind = "above"
+probe = 0
+`, nil, "probe must be given"},
+		{"bad duration", `
+[[rule]]
+name = "quiet"
+kind = "stale"
+min_duration = "a while"
+`, nil, "time: invalid duration"},
+		{"stale without duration", `
+[[rule]]
+name = "quiet"
+kind = "stale"
+`, nil, "need a minimum duration"},
+		{"empty range", `
+[[rule]]
+name = "pit"
+kind = "outside"
+probe = 1
+low = 125
+high = 105
+`, nil, "low must be below high"},
+		{"missing name", `
+[[rule]]
+kind = "above"
+probe = 1
+`, nil, "rule has no name"},
+		{"invalid toml", `[[rule]`, nil, "expected"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseRules(strings.NewReader(test.in))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+)
+
+func battery(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	conn := addConnectionFlags(fs, false)
+	format := fs.String("format", tableFormat, "output format ('table', 'json' or 'csv')")
+	fs.Parse(args)
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	bbq, err := conn.connect(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer bbq.Close()
+	ctx, cancel := context.WithTimeout(ctx, conn.timeout)
+	defer cancel()
+	level, err := bbq.RequestBatteryLevel(ctx)
+	if err != nil {
+		return err
+	}
+	out := newOutput(os.Stdout, *format)
+	if err = out.setHeader("time", "percent", "voltage"); err != nil {
+		return err
+	}
+	return out.write(level.Time, level.Percent, float64(level.Voltage)/1000)
+}
@@ -0,0 +1,492 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/cook"
+	"github.com/sworisbreathing/go-ibbq/v2/estimate"
+	"github.com/sworisbreathing/go-ibbq/v2/rate"
+)
+
+// maxHistory is how many readings each probe's sparkline can show.
+const maxHistory = 1024
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+var (
+	boldStyle    = tcell.StyleDefault.Bold(true)
+	dimStyle     = tcell.StyleDefault.Dim(true)
+	reachedStyle = tcell.StyleDefault.Foreground(tcell.ColorGreen).Bold(true)
+	warningStyle = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+)
+
+// dashboard shows the latest readings in the terminal. Only the event loop draws; other goroutines update the
+// dashboard's state and post an event to have it redrawn.
+type dashboard struct {
+	screen     tcell.Screen
+	title      string
+	names      []string
+	targets    map[int]float64
+	rates      *rate.Calculator
+	estimator  *estimate.Estimator
+	replaying  bool
+	mu         sync.Mutex
+	bbq        *ibbq.Ibbq
+	fahrenheit bool
+	reading    *ibbq.Reading
+	history    [][]float64
+	message    string
+}
+
+// maxHeldLogs is how many log lines are held while the dashboard is shown. Older ones are dropped.
+const maxHeldLogs = 100
+
+// heldWriter passes logs on to w, except while the dashboard is shown, when the latest are held instead,
+// so that they can be written out once the terminal has been restored.
+type heldWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	holding bool
+	held    [][]byte
+	dropped int
+}
+
+func (h *heldWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.holding {
+		return h.w.Write(p)
+	}
+	if len(h.held) == maxHeldLogs {
+		h.held[0] = nil
+		h.held = h.held[1:]
+		h.dropped++
+	}
+	h.held = append(h.held, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+// hold starts holding logs.
+func (h *heldWriter) hold() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.holding = true
+}
+
+// release writes out the logs which were held, and stops holding them.
+func (h *heldWriter) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.dropped > 0 {
+		fmt.Fprintf(h.w, "(%d earlier log lines dropped)\n", h.dropped)
+	}
+	for _, p := range h.held {
+		h.w.Write(p)
+	}
+	h.holding, h.held, h.dropped = false, nil, 0
+}
+
+// newDashboard takes over the terminal, until the dashboard is closed.
+func newDashboard(title string, names []string, targets map[int]float64, ambientProbe int, fahrenheit bool) (*dashboard, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
+	}
+	if err = screen.Init(); err != nil {
+		return nil, err
+	}
+	// logs would be drawn over the dashboard
+	logs.hold()
+	config := estimate.DefaultConfiguration
+	config.AmbientProbe = ambientProbe
+	config.Targets = map[int]float64{}
+	for probe, target := range targets {
+		config.Targets[probe] = target
+	}
+	return &dashboard{
+		screen:     screen,
+		title:      title,
+		names:      names,
+		targets:    targets,
+		rates:      rate.NewCalculator(rate.DefaultConfiguration, nil),
+		estimator:  estimate.NewEstimator(config, nil),
+		fahrenheit: fahrenheit,
+	}, nil
+}
+
+// close restores the terminal, and writes out the logs held while it was shown.
+func (d *dashboard) close() {
+	d.screen.Fini()
+	logs.release()
+}
+
+// setThermometer sets the thermometer whose state is shown, and whose alarm can be silenced.
+func (d *dashboard) setThermometer(bbq *ibbq.Ibbq) {
+	d.mu.Lock()
+	d.bbq = bbq
+	d.mu.Unlock()
+	d.redraw()
+}
+
+// Update records a reading, and has the dashboard redrawn. It is meant to be called from a reading handler.
+func (d *dashboard) Update(reading ibbq.Reading) {
+	d.rates.Update(reading)
+	d.estimator.Update(reading)
+	d.mu.Lock()
+	d.reading = &reading
+	for len(d.history) < len(reading.Temperatures) {
+		d.history = append(d.history, nil)
+	}
+	for probe, temperature := range reading.Temperatures {
+		if !ibbq.ProbeConnected(temperature) {
+			temperature = math.NaN()
+		}
+		history := append(d.history[probe], temperature)
+		if len(history) > maxHistory {
+			history = append(history[:0], history[len(history)-maxHistory:]...)
+		}
+		d.history[probe] = history
+	}
+	d.mu.Unlock()
+	d.redraw()
+}
+
+// show sets the message shown at the bottom of the screen.
+func (d *dashboard) show(message string) {
+	d.mu.Lock()
+	d.message = message
+	d.mu.Unlock()
+	d.redraw()
+}
+
+func (d *dashboard) redraw() {
+	d.screen.PostEvent(tcell.NewEventInterrupt(nil))
+}
+
+// run shows the dashboard until the context is done or the user quits.
+func (d *dashboard) run(ctx context.Context) {
+	go func() {
+		// redraw every second, to keep the reading's age up to date, and once the context is done, to quit
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				d.redraw()
+				return
+			case <-ticker.C:
+				d.redraw()
+			}
+		}
+	}()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		d.draw()
+		switch ev := d.screen.PollEvent().(type) {
+		case nil:
+			return
+		case *tcell.EventResize:
+			d.screen.Sync()
+		case *tcell.EventKey:
+			switch {
+			case ev.Key() == tcell.KeyEscape, ev.Key() == tcell.KeyCtrlC, ev.Rune() == 'q':
+				return
+			case ev.Rune() == 'u':
+				d.mu.Lock()
+				d.fahrenheit = !d.fahrenheit
+				d.mu.Unlock()
+			case ev.Rune() == 's':
+				d.silence()
+			}
+		}
+	}
+}
+
+// silence silences the device's alarm, in the background as it waits for the device.
+func (d *dashboard) silence() {
+	d.mu.Lock()
+	bbq := d.bbq
+	d.mu.Unlock()
+	if bbq == nil {
+		d.show("Not connected to a thermometer")
+		return
+	}
+	d.show("Silencing alarm...")
+	go func() {
+		if err := bbq.SilenceAlarm(); err != nil {
+			d.show("Error silencing alarm: " + err.Error())
+			return
+		}
+		d.show("Alarm silenced")
+	}()
+}
+
+func (d *dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.screen
+	s.Clear()
+	width, height := s.Size()
+	convert, units := d.units()
+
+	x := d.print(0, 0, boldStyle, d.title)
+	if d.bbq == nil && !d.replaying {
+		x = d.print(x+2, 0, warningStyle, string(ibbq.Connecting))
+	}
+	if d.bbq != nil {
+		if address := d.bbq.Address(); address != "" {
+			x = d.print(x+1, 0, boldStyle, address)
+		}
+		status := d.bbq.Status()
+		style := tcell.StyleDefault
+		if status != ibbq.Connected {
+			style = warningStyle
+		}
+		x = d.print(x+2, 0, style, string(status))
+		if battery, ok := d.bbq.LastBattery(); ok {
+			x = d.print(x+2, 0, tcell.StyleDefault, fmt.Sprintf("Battery %d%% (%.2fV)", battery.Percent, float64(battery.Voltage)/1000))
+		}
+		if signal, ok := d.bbq.LastSignalStrength(); ok {
+			style := tcell.StyleDefault
+			if signal.Weak {
+				style = warningStyle
+			}
+			x = d.print(x+2, 0, style, fmt.Sprintf("RSSI %d dBm", signal.RSSI))
+		}
+	}
+	if d.reading != nil {
+		t := d.reading.Time.Local().Format("15:04:05")
+		if !d.replaying {
+			t = fmt.Sprintf("%s (%s ago)", t, time.Since(d.reading.Time).Truncate(time.Second))
+		}
+		d.print(x+2, 0, dimStyle, t)
+	}
+
+	columns := []struct {
+		name  string
+		width int
+	}{{"PROBE", 5}, {"NAME", 10}, {"TEMP", 9}, {"RATE", 11}, {"TARGET", 8}, {"ETA", 9}}
+	x = 0
+	for _, column := range columns {
+		d.print(x, 2, boldStyle, column.name)
+		x += column.width + 2
+	}
+	d.print(x, 2, boldStyle, "HISTORY")
+	sparkX := x
+
+	for probe, history := range d.history {
+		y := 3 + probe
+		if y >= height-2 {
+			break
+		}
+		style := tcell.StyleDefault
+		fields := make([]string, len(columns))
+		fields[0] = strconv.Itoa(probe + 1)
+		fields[1] = probeNames(d.names, probe+1)[probe]
+		fields[2], fields[3], fields[4], fields[5] = "-", "-", "-", "-"
+		if temperature := history[len(history)-1]; !math.IsNaN(temperature) {
+			fields[2] = fmt.Sprintf("%.1f%s", convert(temperature), units)
+		} else {
+			style = dimStyle
+		}
+		if r, ok := d.rates.Rate(probe); ok {
+			if d.fahrenheit {
+				r = r * 9 / 5
+			}
+			fields[3] = fmt.Sprintf("%+.1f%s/min", r, units)
+		}
+		if target, ok := d.targets[probe]; ok {
+			fields[4] = fmt.Sprintf("%.0f%s", convert(target), units)
+		}
+		if e, ok := d.estimator.Estimate(probe); ok {
+			if e.Reached {
+				fields[5] = "reached"
+				style = reachedStyle
+			} else {
+				fields[5] = formatRemaining(e.ETA.Sub(e.Time))
+			}
+		}
+		x = 0
+		for i, field := range fields {
+			d.print(x, y, style, field)
+			x += columns[i].width + 2
+		}
+		d.sparkline(sparkX, y, width-sparkX, history)
+	}
+
+	help := "q quit  u units  s silence alarm"
+	d.print(0, height-1, dimStyle, help)
+	d.print(len(help)+4, height-1, warningStyle, d.message)
+	s.Show()
+}
+
+// units returns the conversion from celsius to the units being shown, and their symbol.
+func (d *dashboard) units() (func(float64) float64, string) {
+	if d.fahrenheit {
+		convert, _ := converter("f")
+		return convert, "°F"
+	}
+	convert, _ := converter("c")
+	return convert, "°C"
+}
+
+// print prints text, returning the column after it.
+func (d *dashboard) print(x, y int, style tcell.Style, text string) int {
+	for _, r := range text {
+		d.screen.SetContent(x, y, r, nil, style)
+		x++
+	}
+	return x
+}
+
+// sparkline draws the most recent temperatures which fit, scaled between the lowest and highest of them.
+// Readings from an unplugged probe are left blank.
+func (d *dashboard) sparkline(x, y, width int, history []float64) {
+	if width <= 0 {
+		return
+	}
+	if len(history) > width {
+		history = history[len(history)-width:]
+	}
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, t := range history {
+		if !math.IsNaN(t) {
+			low, high = math.Min(low, t), math.Max(high, t)
+		}
+	}
+	for i, t := range history {
+		if math.IsNaN(t) {
+			continue
+		}
+		level := 0
+		if high > low {
+			level = int((t - low) / (high - low) * float64(len(sparks)-1))
+		}
+		d.screen.SetContent(x+i, y, sparks[level], nil, tcell.StyleDefault)
+	}
+}
+
+// formatRemaining formats the time left to reach a target to the minute.
+func formatRemaining(remaining time.Duration) string {
+	if remaining < time.Minute {
+		return "<1m"
+	}
+	remaining = remaining.Round(time.Minute)
+	if remaining < time.Hour {
+		return fmt.Sprintf("%dm", remaining/time.Minute)
+	}
+	return fmt.Sprintf("%dh%02dm", remaining/time.Hour, remaining%time.Hour/time.Minute)
+}
+
+// dashboardOptions are the monitor command's flags for the dashboard.
+type dashboardOptions struct {
+	names        []string
+	targets      map[int]float64
+	ambientProbe int
+	fahrenheit   bool
+	replay       string
+	speed        float64
+}
+
+// monitorDashboard shows a thermometer's readings, or a recorded session's, on a dashboard until the user quits.
+func monitorDashboard(ctx context.Context, conn *connection, options dashboardOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if options.replay != "" {
+		return replayDashboard(ctx, options)
+	}
+	d, err := newDashboard("iBBQ", options.names, options.targets, options.ambientProbe, options.fahrenheit)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bbq, err := conn.connect(ctx, d.Update)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.show("Error connecting: " + err.Error())
+			}
+			return
+		}
+		defer bbq.Close()
+		d.setThermometer(bbq)
+		select {
+		case <-ctx.Done():
+		case <-bbq.Disconnected():
+			d.show("Thermometer disconnected")
+			<-ctx.Done()
+		}
+	}()
+	d.run(ctx)
+	cancel()
+	<-done
+	return nil
+}
+
+// replayDashboard replays a cook session saved as JSON. Its probe names and targets are used unless others are given.
+func replayDashboard(ctx context.Context, options dashboardOptions) error {
+	file, err := os.Open(options.replay)
+	if err != nil {
+		return err
+	}
+	session, err := cook.Load(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	metadata := session.Metadata()
+	names := options.names
+	if names == nil {
+		for probe, name := range metadata.Probes {
+			for len(names) <= probe {
+				names = append(names, "")
+			}
+			names[probe] = name
+		}
+	}
+	targets := options.targets
+	if len(targets) == 0 {
+		targets = metadata.Targets
+	}
+	d, err := newDashboard("Replay: "+session.Name(), names, targets, options.ambientProbe, options.fahrenheit)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	d.replaying = true
+	go func() {
+		if err := session.Replay(ctx, d.Update, options.speed); err == nil {
+			d.show("Replay finished")
+		}
+	}()
+	d.run(ctx)
+	return nil
+}
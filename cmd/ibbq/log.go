@@ -0,0 +1,60 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strings"
+
+	"github.com/sworisbreathing/go-ibbq/v2/recorder"
+)
+
+// record is the log command, which records readings to a file until interrupted.
+func record(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	conn := addConnectionFlags(fs, true)
+	format := fs.String("format", string(recorder.CSV), "file format ('csv' or 'jsonl')")
+	probes := fs.String("probes", "", "comma-separated probe names, e.g. 'pit,flat,point'")
+	rotateSize := fs.Int64("rotate-size", 0, "size in megabytes at which the file is rotated (0 to disable)")
+	rotateDaily := fs.Bool("rotate-daily", false, "rotate the file at midnight")
+	syncInterval := fs.Duration("sync", recorder.DefaultConfiguration.SyncInterval, "longest time between syncing the file to disk")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing file")
+	}
+	config := recorder.DefaultConfiguration
+	config.Path = fs.Arg(0)
+	config.Format = recorder.Format(*format)
+	if *probes != "" {
+		config.ProbeNames = strings.Split(*probes, ",")
+	}
+	config.MaxSize = *rotateSize * 1024 * 1024
+	config.Daily = *rotateDaily
+	config.SyncInterval = *syncInterval
+	rec, err := recorder.NewRecorder(config)
+	if err != nil {
+		return err
+	}
+	defer rec.Close()
+	bbq, err := conn.connect(ctx, rec.Update)
+	if err != nil {
+		return err
+	}
+	defer bbq.Close()
+	return wait(ctx, bbq)
+}
@@ -0,0 +1,182 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Command ibbq scans for, monitors and configures iBBQ thermometers.
+//
+//	ibbq scan                      list nearby thermometers
+//	ibbq monitor                   stream readings as a table, JSON or CSV
+//	ibbq set units c|f             change the units the device displays
+//	ibbq set alarm PROBE [LOW] HIGH
+//	                               set a probe's alarm range, in celsius
+//	ibbq battery                   read the battery level once
+//	ibbq log FILE                  record readings to a CSV or JSON Lines file
+//
+// Run "ibbq COMMAND -h" for each command's flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mgutz/logxi/v1"
+	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/recorder"
+)
+
+var logger = log.New("main")
+
+// logs go to stderr, so that they aren't mixed in with JSON or CSV output, and are held while the dashboard is shown.
+var logs = &heldWriter{w: os.Stderr}
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(ctx context.Context, fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"scan", "scan [flags]", "list nearby thermometers", scan},
+	{"monitor", "monitor [flags]", "stream readings as a table, JSON or CSV", monitor},
+	{"set", "set [flags] units c|f | alarm PROBE [LOW] HIGH", "configure a thermometer", set},
+	{"battery", "battery [flags]", "read the battery level once", battery},
+	{"log", "log [flags] FILE", "record readings to a CSV or JSON Lines file", record},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: ibbq COMMAND [flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", c.name, c.description)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `Run "ibbq COMMAND -h" for each command's flags.`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	logTo(logs)
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		interrupts := make(chan os.Signal, 1)
+		signal.Notify(interrupts, os.Interrupt)
+		go func() {
+			<-interrupts
+			cancel()
+		}()
+		if err := c.run(ctx, newFlagSet(c), os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "ibbq %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if name != "-h" && name != "-help" && name != "help" {
+		fmt.Fprintf(os.Stderr, "ibbq: unknown command %q\n", name)
+	}
+	usage()
+	os.Exit(2)
+}
+
+// logTo sends our logs, and those of the packages we use, to w. It must be called before using those packages.
+func logTo(w io.Writer) {
+	logger = log.NewLogger(w, "main")
+	ibbq.SetLogger(log.NewLogger(w, "ibbq"))
+	recorder.SetLogger(log.NewLogger(w, "recorder"))
+}
+
+// newFlagSet creates the flag set for a command, with usage showing the command's arguments.
+func newFlagSet(c command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: ibbq %s\n\n%s.\n\nFlags:\n", c.usage, strings.ToUpper(c.description[:1])+c.description[1:])
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// connection holds the flags which select and connect to a thermometer.
+type connection struct {
+	address  string
+	deviceID int
+	timeout  time.Duration
+	interval time.Duration
+}
+
+func addConnectionFlags(fs *flag.FlagSet, sampling bool) *connection {
+	c := &connection{}
+	fs.StringVar(&c.address, "address", "", "address of the thermometer (the first one found if empty)")
+	fs.IntVar(&c.deviceID, "device-id", -1, "HCI device index of the Bluetooth adapter (-1 for the default)")
+	fs.DurationVar(&c.timeout, "timeout", 30*time.Second, "how long to wait for the thermometer")
+	if sampling {
+		fs.DurationVar(&c.interval, "interval", 0, "time between readings (0 for about once a second)")
+	}
+	return c
+}
+
+// connect connects to the thermometer. The caller must close it.
+func (c *connection) connect(ctx context.Context, readingHandler ibbq.ReadingHandler) (*ibbq.Ibbq, error) {
+	config := ibbq.DefaultConfiguration
+	config.Address = c.address
+	config.DeviceID = c.deviceID
+	config.ConnectTimeout = c.timeout
+	// readings are written out in the order they were received
+	config.DispatchMode = ibbq.SerialDispatch
+	// the units are only changed when asked to, with "ibbq set units"
+	config.KeepDisplayUnits = true
+	if c.interval > 0 {
+		config.SamplingMode = ibbq.IntervalSampling
+		config.SamplingInterval = c.interval
+	}
+	bbq, err := ibbq.NewIbbq(ctx, config, nil, nil, nil, func(status ibbq.Status) {
+		logger.Info("Status updated", "status", status)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if readingHandler != nil {
+		bbq.SetReadingHandler(readingHandler)
+	}
+	if err = bbq.Connect(); err != nil {
+		bbq.Close()
+		return nil, err
+	}
+	return &bbq, nil
+}
+
+// wait waits until the context is done or the thermometer disconnects, which is an error.
+func wait(ctx context.Context, bbq *ibbq.Ibbq) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-bbq.Disconnected():
+		return fmt.Errorf("thermometer disconnected")
+	}
+}
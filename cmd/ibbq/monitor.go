@@ -0,0 +1,132 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/estimate"
+)
+
+func monitor(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	conn := addConnectionFlags(fs, true)
+	format := fs.String("format", tableFormat, "output format ('table', 'json' or 'csv')")
+	probes := fs.String("probes", "", "comma-separated probe names, e.g. 'pit,flat,point'")
+	units := fs.String("units", "c", "temperature units ('c' or 'f')")
+	count := fs.Int("count", 0, "number of readings after which to stop (0 to run until interrupted)")
+	tui := fs.Bool("tui", false, "show a dashboard instead of streaming readings")
+	targets := fs.String("targets", "", "dashboard target temperatures in celsius, by probe number (e.g. '1=93,2=74')")
+	ambientProbe := fs.Int("ambient-probe", 0, "number of the probe measuring the cooker's temperature, for the dashboard (0 if there isn't one)")
+	replay := fs.String("replay", "", "cook session file to replay on the dashboard, instead of connecting")
+	speed := fs.Float64("speed", 60, "how many times faster than recorded to replay the session (0 for as fast as possible)")
+	fs.Parse(args)
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	convert, err := converter(*units)
+	if err != nil {
+		return err
+	}
+	var names []string
+	if *probes != "" {
+		names = strings.Split(*probes, ",")
+	}
+	if *tui || *replay != "" {
+		options := dashboardOptions{
+			names:        names,
+			ambientProbe: *ambientProbe - 1,
+			fahrenheit:   strings.HasPrefix(strings.ToLower(*units), "f"),
+			replay:       *replay,
+			speed:        *speed,
+		}
+		if options.targets, err = estimate.ParseTargets(*targets); err != nil {
+			return err
+		}
+		return monitorDashboard(ctx, conn, options)
+	}
+	readings := make(chan ibbq.Reading, 16)
+	bbq, err := conn.connect(ctx, func(reading ibbq.Reading) {
+		select {
+		case readings <- reading:
+		default:
+			logger.Warn("Output is falling behind, dropped reading")
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer bbq.Close()
+	out := newOutput(os.Stdout, *format)
+	for n := 0; *count == 0 || n < *count; n++ {
+		var reading ibbq.Reading
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-bbq.Disconnected():
+			return wait(ctx, bbq)
+		case reading = <-readings:
+		}
+		if out.header == nil {
+			if err = out.setHeader(append([]string{"time"}, probeNames(names, len(reading.Temperatures))...)...); err != nil {
+				return err
+			}
+		}
+		values := []interface{}{reading.Time}
+		for probe := range out.header[1:] {
+			var temperature *float64
+			if probe < len(reading.Temperatures) && ibbq.ProbeConnected(reading.Temperatures[probe]) {
+				t := convert(reading.Temperatures[probe])
+				temperature = &t
+			}
+			values = append(values, temperature)
+		}
+		if err = out.write(values...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeNames names each probe, using probe1, probe2, etc. for probes without a name.
+func probeNames(names []string, probes int) []string {
+	result := make([]string, probes)
+	for probe := range result {
+		if probe < len(names) && names[probe] != "" {
+			result[probe] = names[probe]
+		} else {
+			result[probe] = "probe" + strconv.Itoa(probe+1)
+		}
+	}
+	return result
+}
+
+// converter returns a function converting celsius to the given units.
+func converter(units string) (func(float64) float64, error) {
+	switch strings.ToLower(units) {
+	case "c", "celsius":
+		return func(t float64) float64 { return t }, nil
+	case "f", "fahrenheit":
+		return func(t float64) float64 { return math.Round((t*9/5+32)*10) / 10 }, nil
+	}
+	return nil, fmt.Errorf("unknown units %q (want c or f)", units)
+}
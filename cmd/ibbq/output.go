@@ -0,0 +1,170 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output formats. JSON is written as one object per line, so that it can be streamed.
+const (
+	tableFormat = "table"
+	jsonFormat  = "json"
+	csvFormat   = "csv"
+)
+
+func checkFormat(format string) error {
+	switch format {
+	case tableFormat, jsonFormat, csvFormat:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q (want table, json or csv)", format)
+}
+
+// output writes rows in one of the output formats. Each row is a list of fields, named by the header.
+// Values are written as JSON as they are; in tables and CSV nil is written as an empty field, or "-" in tables.
+type output struct {
+	w      io.Writer
+	format string
+	header []string
+	widths []int
+	csv    *csv.Writer
+}
+
+func newOutput(w io.Writer, format string) *output {
+	return &output{w: w, format: format, csv: csv.NewWriter(w)}
+}
+
+// setHeader names the fields, writing a header line for tables and CSV.
+func (o *output) setHeader(header ...string) error {
+	o.header = header
+	o.widths = make([]int, len(header))
+	for i, name := range header {
+		o.widths[i] = minColumnWidth
+		if width, ok := columnWidths[name]; ok {
+			o.widths[i] = width
+		}
+		if o.widths[i] < len(name) {
+			o.widths[i] = len(name)
+		}
+	}
+	switch o.format {
+	case tableFormat:
+		fields := make([]string, len(header))
+		for i, name := range header {
+			fields[i] = strings.ToUpper(name)
+		}
+		return o.writeTable(fields)
+	case csvFormat:
+		return o.writeCSV(header)
+	}
+	return nil
+}
+
+const tableTimeFormat = "2006-01-02 15:04:05"
+
+// minColumnWidth fits most temperatures.
+const minColumnWidth = 6
+
+// columnWidths are the table widths of columns whose values are longer than that.
+var columnWidths = map[string]int{
+	"time":    len(tableTimeFormat),
+	"address": len("c4:7c:8d:6a:1f:2b"),
+}
+
+// write writes a row.
+func (o *output) write(values ...interface{}) error {
+	if o.format == jsonFormat {
+		// written by hand, to keep the fields in order
+		var b strings.Builder
+		b.WriteByte('{')
+		for i, value := range values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			key, _ := json.Marshal(o.header[i])
+			b.Write(key)
+			b.WriteByte(':')
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			b.Write(encoded)
+		}
+		b.WriteString("}\n")
+		_, err := io.WriteString(o.w, b.String())
+		return err
+	}
+	fields := make([]string, len(values))
+	for i, value := range values {
+		fields[i] = o.field(value)
+	}
+	if o.format == tableFormat {
+		return o.writeTable(fields)
+	}
+	return o.writeCSV(fields)
+}
+
+func (o *output) field(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		if o.format == tableFormat {
+			return "-"
+		}
+		return ""
+	case time.Time:
+		if o.format == tableFormat {
+			return v.Local().Format(tableTimeFormat)
+		}
+		return v.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case *float64:
+		if v == nil {
+			return o.field(nil)
+		}
+		return o.field(*v)
+	}
+	return fmt.Sprint(value)
+}
+
+func (o *output) writeTable(fields []string) error {
+	var b strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString("  ")
+		}
+		width := len(field)
+		if i < len(o.widths) {
+			width = o.widths[i]
+		}
+		fmt.Fprintf(&b, "%-*s", width, field)
+	}
+	_, err := fmt.Fprintln(o.w, strings.TrimRight(b.String(), " "))
+	return err
+}
+
+func (o *output) writeCSV(fields []string) error {
+	o.csv.Write(fields)
+	o.csv.Flush()
+	return o.csv.Error()
+}
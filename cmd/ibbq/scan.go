@@ -0,0 +1,70 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+func scan(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	duration := fs.Duration("duration", 10*time.Second, "how long to scan for")
+	deviceID := fs.Int("device-id", -1, "HCI device index of the Bluetooth adapter (-1 for the default)")
+	format := fs.String("format", tableFormat, "output format ('table', 'json' or 'csv')")
+	fs.Parse(args)
+	if err := checkFormat(*format); err != nil {
+		return err
+	}
+	var opts []ble.Option
+	if *deviceID >= 0 {
+		opts = append(opts, ble.OptDeviceID(*deviceID))
+	}
+	d, err := ibbq.NewDevice("default", opts...)
+	if err != nil {
+		return err
+	}
+	defer d.Stop()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+	// keep the latest advertisement from each thermometer
+	found := map[string]ibbq.Thermometer{}
+	if err = ibbq.Scan(ctx, d, func(t ibbq.Thermometer) {
+		found[t.Address] = t
+	}); err != nil {
+		return err
+	}
+	thermometers := make([]ibbq.Thermometer, 0, len(found))
+	for _, t := range found {
+		thermometers = append(thermometers, t)
+	}
+	sort.Slice(thermometers, func(i, j int) bool { return thermometers[i].Address < thermometers[j].Address })
+	out := newOutput(os.Stdout, *format)
+	if err = out.setHeader("address", "name", "rssi"); err != nil {
+		return err
+	}
+	for _, t := range thermometers {
+		if err = out.write(t.Address, t.Name, t.RSSI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
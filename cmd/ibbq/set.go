@@ -0,0 +1,98 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func set(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	conn := addConnectionFlags(fs, false)
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("missing setting")
+	}
+	switch args[0] {
+	case "units":
+		return setUnits(ctx, conn, args[1:])
+	case "alarm":
+		return setAlarm(ctx, conn, args[1:])
+	}
+	return fmt.Errorf("unknown setting %q (want units or alarm)", args[0])
+}
+
+// setUnits sets the units the device displays: set units c|f
+func setUnits(ctx context.Context, conn *connection, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: set units c|f")
+	}
+	units := strings.ToLower(args[0])
+	switch units {
+	case "c", "celsius", "f", "fahrenheit":
+	default:
+		return fmt.Errorf("unknown units %q (want c or f)", args[0])
+	}
+	bbq, err := conn.connect(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer bbq.Close()
+	if units[0] == 'f' {
+		return bbq.ConfigureTemperatureFahrenheit()
+	}
+	return bbq.ConfigureTemperatureCelsius()
+}
+
+// setAlarm sets a probe's alarm range, in celsius: set alarm PROBE [LOW] HIGH
+// Probes are numbered from 1. Without a low temperature, the alarm only sounds above the high one.
+func setAlarm(ctx context.Context, conn *connection, args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return errors.New("usage: set alarm PROBE [LOW] HIGH")
+	}
+	probe, err := strconv.Atoi(args[0])
+	if err != nil || probe < 1 {
+		return fmt.Errorf("invalid probe %q", args[0])
+	}
+	var low float64
+	if len(args) == 3 {
+		if low, err = strconv.ParseFloat(args[1], 64); err != nil {
+			return fmt.Errorf("invalid low temperature %q", args[1])
+		}
+	}
+	high, err := strconv.ParseFloat(args[len(args)-1], 64)
+	if err != nil {
+		return fmt.Errorf("invalid high temperature %q", args[len(args)-1])
+	}
+	if len(args) == 3 && low > high {
+		return errors.New("low temperature must not be above high temperature")
+	}
+	bbq, err := conn.connect(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer bbq.Close()
+	if len(args) == 2 {
+		return bbq.SetProbeHighAlarm(probe-1, high)
+	}
+	return bbq.SetProbeAlarm(probe-1, low, high)
+}
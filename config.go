@@ -18,18 +18,76 @@ package ibbq
 import (
 	"errors"
 	"time"
+
+	"github.com/go-ble/ble"
 )
 
 // Configuration configures our ibbq session
 type Configuration struct {
 	ConnectTimeout         time.Duration `description:"Connection timeout"`
 	BatteryPollingInterval time.Duration `description:"Battery level polling interval"`
+	// LoginStrategy performs the login handshake. When nil, the default iBBQ credentials are used.
+	LoginStrategy LoginStrategy `description:"Login strategy"`
+	// Backend names the device implementation. An empty string selects the platform default.
+	Backend string `description:"Device implementation"`
+	// DeviceID selects the HCI device index (e.g. 1 for hci1). A negative value selects the first available device.
+	DeviceID int `description:"HCI device index"`
+	// DeviceOptions are passed to the device implementation, e.g. ble.OptConnParams.
+	DeviceOptions []ble.Option `description:"Device options"`
+	// SharedDevice, if set, is used instead of creating a device, so that several Ibbqs can share an adapter.
+	// Backend, DeviceID and DeviceOptions are ignored when it is set.
+	SharedDevice *SharedDevice `description:"Device shared with other Ibbqs"`
+	// Address, if set, selects the thermometer to connect to by its address, e.g. "c4:7c:8d:6a:1f:2b".
+	// Otherwise the first thermometer found is connected to.
+	Address string `description:"Address of the thermometer to connect to"`
+	// KeepDisplayUnits leaves the units the device displays as they are when connecting.
+	// Otherwise the device is switched to displaying celsius.
+	KeepDisplayUnits bool `description:"Don't switch the device to displaying celsius when connecting"`
+	// MaxHandlerPanics is the number of consecutive panics after which a handler is no longer called.
+	// Zero keeps calling handlers regardless of how often they panic.
+	MaxHandlerPanics int `description:"Consecutive handler panics before the handler is disabled"`
+	// DispatchMode controls whether handlers run concurrently or serially in the order events were received.
+	DispatchMode DispatchMode `description:"Handler dispatch mode ('concurrent' or 'serial')"`
+	// DispatchQueueSize bounds the number of events awaiting serial dispatch.
+	// Temperature and battery events are dropped while the queue is full, and only the latest status update is kept.
+	DispatchQueueSize int `description:"Maximum number of events awaiting serial dispatch"`
+	// SamplingMode controls how often the device sends real-time data.
+	// Anything other than continuous sampling switches real-time data off between samples to save battery.
+	SamplingMode SamplingMode `description:"Sampling mode ('continuous', 'interval' or 'adaptive')"`
+	// SamplingInterval is the time between samples in interval and adaptive sampling modes,
+	// where it must be positive.
+	SamplingInterval time.Duration `description:"Time between samples"`
+	// FastSamplingInterval is the time between samples in adaptive mode while temperatures are changing quickly.
+	// It must be positive in adaptive mode.
+	FastSamplingInterval time.Duration `description:"Time between samples while temperatures change quickly"`
+	// AdaptiveSamplingThreshold is the rate of change, in degrees celsius per minute,
+	// above which adaptive mode switches to the fast sampling interval. It must be positive in adaptive mode.
+	AdaptiveSamplingThreshold float64 `description:"Rate of change (celsius per minute) which triggers fast sampling"`
+	// RSSIPollingInterval is the time between signal strength readings while connected. Zero disables polling.
+	RSSIPollingInterval time.Duration `description:"RSSI polling interval"`
+	// WeakSignalThreshold is the RSSI, in dBm, below which the signal is considered weak.
+	// Zero disables flagging weak signals.
+	WeakSignalThreshold int `description:"RSSI (dBm) below which the signal is considered weak"`
+	// Filters process each probe's temperatures, e.g. to smooth out noise, before they are passed to handlers.
+	Filters FilterConfiguration `description:"Filters applied to each probe's temperatures"`
+	// Deadband suppresses temperature events while temperatures aren't changing.
+	Deadband DeadbandConfiguration `description:"Deadband filter for temperature events"`
 }
 
 // DefaultConfiguration is a somewhat sane default.
 var DefaultConfiguration = Configuration{
-	ConnectTimeout:         60 * time.Second,
-	BatteryPollingInterval: 5 * time.Minute,
+	ConnectTimeout:            60 * time.Second,
+	BatteryPollingInterval:    5 * time.Minute,
+	Backend:                   "default",
+	DeviceID:                  -1,
+	DispatchMode:              ConcurrentDispatch,
+	DispatchQueueSize:         64,
+	SamplingMode:              ContinuousSampling,
+	SamplingInterval:          time.Minute,
+	FastSamplingInterval:      10 * time.Second,
+	AdaptiveSamplingThreshold: 1,
+	RSSIPollingInterval:       30 * time.Second,
+	WeakSignalThreshold:       -85,
 }
 
 // NewConfiguration creates a configuration
@@ -37,8 +95,38 @@ func NewConfiguration(connectTimeout time.Duration, batteryPollingInterval time.
 	if connectTimeout < 0 {
 		return Configuration{}, errors.New("connect timeout must not be negative")
 	}
-	return Configuration{
-		ConnectTimeout:         connectTimeout,
-		BatteryPollingInterval: batteryPollingInterval,
-	}, nil
+	config := DefaultConfiguration
+	config.ConnectTimeout = connectTimeout
+	config.BatteryPollingInterval = batteryPollingInterval
+	if err := config.validate(); err != nil {
+		return Configuration{}, err
+	}
+	return config, nil
+}
+
+// validate checks the settings which would otherwise make sampling misbehave.
+func (c Configuration) validate() error {
+	switch c.SamplingMode {
+	case IntervalSampling, AdaptiveSampling:
+		if c.SamplingInterval <= 0 {
+			return errors.New("sampling interval must be positive")
+		}
+	}
+	if c.SamplingMode == AdaptiveSampling {
+		if c.FastSamplingInterval <= 0 {
+			return errors.New("fast sampling interval must be positive")
+		}
+		if c.AdaptiveSamplingThreshold <= 0 {
+			return errors.New("adaptive sampling threshold must be positive")
+		}
+	}
+	return nil
+}
+
+func (c Configuration) deviceOptions() []ble.Option {
+	var opts []ble.Option
+	if c.DeviceID >= 0 {
+		opts = append(opts, ble.OptDeviceID(c.DeviceID))
+	}
+	return append(opts, c.DeviceOptions...)
 }
@@ -35,6 +35,14 @@ const SettingData = "fff5"
 // DeviceName is the name we look for when we scan.
 const DeviceName = "iBBQ"
 
+// UnpluggedTemperature is the temperature reported for probes which aren't plugged in.
+const UnpluggedTemperature = 6552.6
+
+// ProbeConnected reports whether a temperature was read from a probe which is plugged in.
+func ProbeConnected(temperature float64) bool {
+	return temperature < UnpluggedTemperature
+}
+
 // Status represents our connection status
 type Status string
 
@@ -50,18 +58,33 @@ const (
 )
 
 var (
-	// Credentials stores our login credentials for the thermometer.
-	Credentials = []byte{0x21, 0x07, 0x06,
+	defaultCredentials = []byte{0x21, 0x07, 0x06,
 		0x05, 0x04, 0x03, 0x02, 0x01, 0xb8, 0x22,
 		0x00, 0x00, 0x00, 0x00, 0x00}
 
+	// Credentials stores our login credentials for the thermometer.
+	// They are used to log in when Configuration.LoginStrategy is nil.
+	//
+	// Deprecated: use DefaultCredentials, and set Configuration.LoginStrategy to log in with other credentials.
+	Credentials = DefaultCredentials()
+
 	realTimeDataEnable = []byte{0x0B, 0x01, 0x00, 0x00, 0x00, 0x00}
 
+	realTimeDataDisable = []byte{0x0B, 0x00, 0x00, 0x00, 0x00, 0x00}
+
 	unitsFahrenheit = []byte{0x02, 0x01, 0x00, 0x00, 0x00, 0x00}
 
 	unitsCelsius = []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x00}
 
 	batteryLevel = []byte{0x08, 0x24, 0x00, 0x00, 0x00, 0x00}
 
+	silenceAlarm = []byte{0x04, 0xFF, 0x00, 0x00, 0x00, 0x00}
+
 	logger = log.New("ibbq")
 )
+
+// SetLogger replaces the package's logger, e.g. to log to stderr, or to discard logs with log.NullLog.
+// It should be called before creating an Ibbq.
+func SetLogger(l log.Logger) {
+	logger = l
+}
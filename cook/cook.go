@@ -0,0 +1,346 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package cook groups readings into cook sessions, with metadata and annotations,
+// which can be archived as JSON and replayed.
+package cook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+var (
+	// ErrNotStarted is returned when stopping a session which has not been started.
+	ErrNotStarted = errors.New("session has not been started")
+	// ErrAlreadyStarted is returned when starting a session which has already been started.
+	ErrAlreadyStarted = errors.New("session has already been started")
+	// ErrStopped is returned when starting or stopping a session which has already been stopped.
+	ErrStopped = errors.New("session has been stopped")
+)
+
+// Metadata describes what is being cooked, and how.
+type Metadata struct {
+	// Meat is what is being cooked, e.g. "brisket".
+	Meat string `json:"meat,omitempty"`
+	// Weight is the weight of the meat, in kilograms.
+	Weight float64 `json:"weight,omitempty"`
+	// Cooker is the cooker being used, e.g. "kamado".
+	Cooker string `json:"cooker,omitempty"`
+	// Probes names what each probe is measuring, by probe index, e.g. {0: "pit", 1: "flat", 2: "point"}.
+	Probes map[int]string `json:"probes,omitempty"`
+	// Targets are the target temperatures, in celsius, by probe index.
+	Targets map[int]float64 `json:"targets,omitempty"`
+	// Notes are free-form notes about the cook.
+	Notes string `json:"notes,omitempty"`
+}
+
+// Annotation is a timestamped note made during a cook, e.g. "wrapped" or "added charcoal".
+type Annotation struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// Session groups the readings taken between the start and end of a cook. It is safe for concurrent use.
+type Session struct {
+	mu          sync.Mutex
+	id          string
+	name        string
+	started     time.Time
+	stopped     time.Time
+	metadata    Metadata
+	annotations []Annotation
+	readings    []ibbq.Reading
+}
+
+// sessionJSON is the serialized form of a Session.
+type sessionJSON struct {
+	ID          string        `json:"id"`
+	Name        string        `json:"name,omitempty"`
+	Started     *time.Time    `json:"started,omitempty"`
+	Stopped     *time.Time    `json:"stopped,omitempty"`
+	Metadata    Metadata      `json:"metadata"`
+	Annotations []Annotation  `json:"annotations,omitempty"`
+	Readings    []readingJSON `json:"readings,omitempty"`
+}
+
+// readingJSON is the serialized form of a reading.
+type readingJSON struct {
+	Time         time.Time `json:"time"`
+	Temperatures []float64 `json:"temperatures"`
+	Raw          []float64 `json:"raw,omitempty"`
+}
+
+// NewSession creates a session which has not yet been started.
+func NewSession(name string, metadata Metadata) *Session {
+	return &Session{id: newID(), name: name, metadata: metadata}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// ID returns the session's unique identifier.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// Name returns the session's name.
+func (s *Session) Name() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name
+}
+
+// Start starts the session, after which it records readings.
+func (s *Session) Start(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.stopped.IsZero():
+		return ErrStopped
+	case !s.started.IsZero():
+		return ErrAlreadyStarted
+	}
+	s.started = t
+	return nil
+}
+
+// Stop stops the session, after which it ignores readings.
+func (s *Session) Stop(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.stopped.IsZero():
+		return ErrStopped
+	case s.started.IsZero():
+		return ErrNotStarted
+	}
+	s.stopped = t
+	return nil
+}
+
+// Active reports whether the session has been started and not yet stopped.
+func (s *Session) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active()
+}
+
+func (s *Session) active() bool {
+	return !s.started.IsZero() && s.stopped.IsZero()
+}
+
+// Started returns when the session was started, or the zero time if it has not been.
+func (s *Session) Started() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// Stopped returns when the session was stopped, or the zero time if it has not been.
+func (s *Session) Stopped() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// Duration returns how long the session ran, or has been running so far.
+func (s *Session) Duration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.started.IsZero():
+		return 0
+	case s.stopped.IsZero():
+		return time.Since(s.started)
+	}
+	return s.stopped.Sub(s.started)
+}
+
+// Metadata returns the session's metadata.
+func (s *Session) Metadata() Metadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.metadata.copy()
+}
+
+// SetMetadata replaces the session's metadata, e.g. once the meat has been weighed.
+func (s *Session) SetMetadata(metadata Metadata) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metadata = metadata.copy()
+}
+
+func (m Metadata) copy() Metadata {
+	if m.Probes != nil {
+		probes := make(map[int]string, len(m.Probes))
+		for probe, name := range m.Probes {
+			probes[probe] = name
+		}
+		m.Probes = probes
+	}
+	if m.Targets != nil {
+		targets := make(map[int]float64, len(m.Targets))
+		for probe, target := range m.Targets {
+			targets[probe] = target
+		}
+		m.Targets = targets
+	}
+	return m
+}
+
+// Annotate adds an annotation at the current time.
+func (s *Session) Annotate(text string) {
+	s.AnnotateAt(time.Now(), text)
+}
+
+// AnnotateAt adds an annotation at the given time, keeping annotations in time order.
+func (s *Session) AnnotateAt(t time.Time, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := len(s.annotations)
+	for i > 0 && s.annotations[i-1].Time.After(t) {
+		i--
+	}
+	s.annotations = append(s.annotations, Annotation{})
+	copy(s.annotations[i+1:], s.annotations[i:])
+	s.annotations[i] = Annotation{Time: t, Text: text}
+}
+
+// Annotations returns the session's annotations, in time order.
+func (s *Session) Annotations() []Annotation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Annotation(nil), s.annotations...)
+}
+
+// Update records a reading while the session is active. It is meant to be called from a reading handler.
+func (s *Session) Update(reading ibbq.Reading) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active() || reading.Time.Before(s.started) {
+		return
+	}
+	s.readings = append(s.readings, reading)
+}
+
+// Readings returns the readings recorded by the session.
+func (s *Session) Readings() []ibbq.Reading {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ibbq.Reading(nil), s.readings...)
+}
+
+// MarshalJSON serializes the session.
+func (s *Session) MarshalJSON() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := sessionJSON{
+		ID:          s.id,
+		Name:        s.name,
+		Metadata:    s.metadata,
+		Annotations: s.annotations,
+	}
+	for _, reading := range s.readings {
+		v.Readings = append(v.Readings, readingJSON{reading.Time, reading.Temperatures, reading.Raw})
+	}
+	if !s.started.IsZero() {
+		started := s.started
+		v.Started = &started
+	}
+	if !s.stopped.IsZero() {
+		stopped := s.stopped
+		v.Stopped = &stopped
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON restores a serialized session.
+func (s *Session) UnmarshalJSON(data []byte) error {
+	var v sessionJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.id, s.name, s.metadata = v.ID, v.Name, v.Metadata
+	s.annotations, s.readings = v.Annotations, nil
+	for _, reading := range v.Readings {
+		s.readings = append(s.readings, ibbq.Reading{Time: reading.Time, Temperatures: reading.Temperatures, Raw: reading.Raw})
+	}
+	s.started, s.stopped = time.Time{}, time.Time{}
+	if v.Started != nil {
+		s.started = *v.Started
+	}
+	if v.Stopped != nil {
+		s.stopped = *v.Stopped
+	}
+	if s.id == "" {
+		s.id = newID()
+	}
+	return nil
+}
+
+// Save writes the session as JSON.
+func (s *Session) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// Load reads a session written by Save.
+func Load(r io.Reader) (*Session, error) {
+	s := &Session{}
+	if err := json.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Replay feeds the session's readings to a handler, paced as they were recorded but sped up by the given factor.
+// A speed of zero or less replays them as fast as possible. It returns early if the context is done.
+func (s *Session) Replay(ctx context.Context, handler ibbq.ReadingHandler, speed float64) error {
+	readings := s.Readings()
+	for i, reading := range readings {
+		if i > 0 && speed > 0 {
+			wait := time.Duration(float64(reading.Time.Sub(readings[i-1].Time)) / speed)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		handler(reading)
+	}
+	return nil
+}
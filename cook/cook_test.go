@@ -0,0 +1,197 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package cook
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+var start = time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)
+
+func TestLifecycle(t *testing.T) {
+	begin := func(s *Session) error { return s.Start(start) }
+	end := func(s *Session) error { return s.Stop(start.Add(time.Hour)) }
+	tests := []struct {
+		name    string
+		actions []func(*Session) error
+		want    []error
+		active  bool
+	}{
+		{"new", nil, nil, false},
+		{"started", []func(*Session) error{begin}, []error{nil}, true},
+		{"stopped", []func(*Session) error{begin, end}, []error{nil, nil}, false},
+		{"stopped before starting", []func(*Session) error{end}, []error{ErrNotStarted}, false},
+		{"started twice", []func(*Session) error{begin, begin}, []error{nil, ErrAlreadyStarted}, true},
+		{"stopped twice", []func(*Session) error{begin, end, end}, []error{nil, nil, ErrStopped}, false},
+		{"restarted", []func(*Session) error{begin, end, begin}, []error{nil, nil, ErrStopped}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSession(test.name, Metadata{})
+			for i, action := range test.actions {
+				if err := action(s); err != test.want[i] {
+					t.Errorf("action %d: got %v, want %v", i, err, test.want[i])
+				}
+			}
+			if s.Active() != test.active {
+				t.Errorf("got active %v, want %v", s.Active(), test.active)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := NewSession("brisket", Metadata{})
+	reading := func(minutes int) ibbq.Reading {
+		return ibbq.Reading{Time: start.Add(time.Duration(minutes) * time.Minute), Temperatures: []float64{float64(minutes)}}
+	}
+	s.Update(reading(0))
+	s.Start(start.Add(time.Minute))
+	s.Update(reading(0))
+	s.Update(reading(1))
+	s.Update(reading(2))
+	s.Stop(start.Add(3 * time.Minute))
+	s.Update(reading(3))
+	if got, want := s.Readings(), []ibbq.Reading{reading(1), reading(2)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := s.Duration(); got != 2*time.Minute {
+		t.Errorf("got duration %v, want %v", got, 2*time.Minute)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	s := NewSession("brisket", Metadata{})
+	s.AnnotateAt(start.Add(2*time.Hour), "wrapped")
+	s.AnnotateAt(start, "on")
+	s.AnnotateAt(start.Add(time.Hour), "spritzed")
+	s.AnnotateAt(start.Add(2*time.Hour), "added charcoal")
+	var got []string
+	for _, annotation := range s.Annotations() {
+		got = append(got, annotation.Text)
+	}
+	if want := []string{"on", "spritzed", "wrapped", "added charcoal"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMetadataIsCopied(t *testing.T) {
+	metadata := Metadata{Meat: "brisket", Probes: map[int]string{0: "pit"}, Targets: map[int]float64{1: 93}}
+	s := NewSession("brisket", Metadata{})
+	s.SetMetadata(metadata)
+	metadata.Probes[0] = "flat"
+	got := s.Metadata()
+	got.Targets[1] = 95
+	if got := s.Metadata(); got.Probes[0] != "pit" || got.Targets[1] != 93 {
+		t.Errorf("metadata changed to %+v", got)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	metadata := Metadata{Meat: "brisket", Weight: 6.5, Cooker: "kamado", Probes: map[int]string{0: "pit"}, Targets: map[int]float64{1: 93}, Notes: "post oak"}
+	tests := []struct {
+		name    string
+		prepare func(s *Session)
+	}{
+		{"new", func(s *Session) {}},
+		{"active", func(s *Session) {
+			s.Start(start)
+			s.Update(ibbq.Reading{Time: start, Temperatures: []float64{110, 5}, Raw: []float64{111, 5}})
+		}},
+		{"stopped", func(s *Session) {
+			s.Start(start)
+			s.Update(ibbq.Reading{Time: start, Temperatures: []float64{110, 5}})
+			s.AnnotateAt(start.Add(time.Hour), "wrapped")
+			s.Stop(start.Add(2 * time.Hour))
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewSession("brisket", metadata)
+			test.prepare(s)
+			var b bytes.Buffer
+			if err := s.Save(&b); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := Load(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.ID() != s.ID() || loaded.Name() != s.Name() || !loaded.Started().Equal(s.Started()) || !loaded.Stopped().Equal(s.Stopped()) {
+				t.Errorf("got session %s %q from %v to %v, want %s %q from %v to %v",
+					loaded.ID(), loaded.Name(), loaded.Started(), loaded.Stopped(), s.ID(), s.Name(), s.Started(), s.Stopped())
+			}
+			if !reflect.DeepEqual(loaded.Metadata(), s.Metadata()) {
+				t.Errorf("got metadata %+v, want %+v", loaded.Metadata(), s.Metadata())
+			}
+			if !reflect.DeepEqual(loaded.Annotations(), s.Annotations()) {
+				t.Errorf("got annotations %+v, want %+v", loaded.Annotations(), s.Annotations())
+			}
+			if !reflect.DeepEqual(loaded.Readings(), s.Readings()) {
+				t.Errorf("got readings %+v, want %+v", loaded.Readings(), s.Readings())
+			}
+		})
+	}
+}
+
+func TestLoadWithoutID(t *testing.T) {
+	s, err := Load(bytes.NewBufferString(`{"name":"brisket","metadata":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID() == "" {
+		t.Error("loaded session has no ID")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	s := NewSession("brisket", Metadata{})
+	s.Start(start)
+	for i := 0; i < 3; i++ {
+		s.Update(ibbq.Reading{Time: start.Add(time.Duration(i) * time.Minute), Temperatures: []float64{float64(i)}})
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		speed   float64
+		want    int
+		wantErr error
+	}{
+		{"as fast as possible", context.Background(), 0, 3, nil},
+		{"sped up", context.Background(), 6000, 3, nil},
+		{"cancelled", cancelled, 0, 0, context.Canceled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []ibbq.Reading
+			err := s.Replay(test.ctx, func(reading ibbq.Reading) { got = append(got, reading) }, test.speed)
+			if err != test.wantErr {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			if want := s.Readings()[:test.want]; len(got) != test.want || (test.want > 0 && !reflect.DeepEqual(got, want)) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
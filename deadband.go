@@ -0,0 +1,96 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DeadbandConfiguration configures the filter which suppresses temperature events
+// when temperatures haven't changed enough to be interesting.
+type DeadbandConfiguration struct {
+	// Delta is the change, in celsius, a probe must see before an event is emitted. Zero disables the filter.
+	Delta float64 `description:"Change in temperature (celsius) required to emit an event"`
+	// ProbeDeltas overrides Delta for individual probes, keyed by probe index.
+	ProbeDeltas map[int]float64 `description:"Per-probe change in temperature (celsius) required to emit an event"`
+	// MaxInterval is the longest time between events, however little temperatures have changed. Zero means no limit.
+	MaxInterval time.Duration `description:"Maximum time between events"`
+}
+
+func (c DeadbandConfiguration) delta(probe int) float64 {
+	if delta, ok := c.ProbeDeltas[probe]; ok {
+		return delta
+	}
+	return c.Delta
+}
+
+func (c DeadbandConfiguration) enabled() bool {
+	if c.Delta > 0 {
+		return true
+	}
+	for _, delta := range c.ProbeDeltas {
+		if delta > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// deadband decides which readings are passed on to the temperature handlers.
+type deadband struct {
+	mu      sync.Mutex
+	config  DeadbandConfiguration
+	emitted *Reading
+}
+
+func newDeadband(config DeadbandConfiguration) *deadband {
+	return &deadband{config: config}
+}
+
+// accept reports whether reading differs enough from the last accepted reading to be emitted.
+func (d *deadband) accept(reading Reading) bool {
+	if !d.config.enabled() {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.emitted == nil || d.changed(*d.emitted, reading) ||
+		(d.config.MaxInterval > 0 && reading.Time.Sub(d.emitted.Time) >= d.config.MaxInterval) {
+		d.emitted = &reading
+		return true
+	}
+	return false
+}
+
+func (d *deadband) changed(previous, current Reading) bool {
+	if len(previous.Temperatures) != len(current.Temperatures) {
+		return true
+	}
+	for i, temperature := range current.Temperatures {
+		previousTemperature := previous.Temperatures[i]
+		if ProbeConnected(temperature) != ProbeConnected(previousTemperature) {
+			return true
+		}
+		delta := d.config.delta(i)
+		change := math.Abs(temperature - previousTemperature)
+		if (delta > 0 && change >= delta) || (delta <= 0 && change > 0) {
+			return true
+		}
+	}
+	return false
+}
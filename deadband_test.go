@@ -0,0 +1,94 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadband(t *testing.T) {
+	type step struct {
+		after        time.Duration
+		temperatures []float64
+		want         bool
+	}
+	tests := []struct {
+		name   string
+		config DeadbandConfiguration
+		steps  []step
+	}{
+		{"disabled", DeadbandConfiguration{}, []step{
+			{0, []float64{100}, true},
+			{time.Second, []float64{100}, true},
+		}},
+		{"delta", DeadbandConfiguration{Delta: 1}, []step{
+			{0, []float64{100, 50}, true},
+			{time.Second, []float64{100.5, 50}, false},
+			{time.Second, []float64{100.9, 50.9}, false},
+			{time.Second, []float64{101, 50}, true},
+			{time.Second, []float64{101, 49}, true},
+		}},
+		{"changes are measured from the last event", DeadbandConfiguration{Delta: 1}, []step{
+			{0, []float64{100}, true},
+			{time.Second, []float64{100.6}, false},
+			{time.Second, []float64{101.2}, true},
+			{time.Second, []float64{101.8}, false},
+		}},
+		{"probe delta", DeadbandConfiguration{Delta: 1, ProbeDeltas: map[int]float64{1: 5}}, []step{
+			{0, []float64{100, 50}, true},
+			{time.Second, []float64{100, 54}, false},
+			{time.Second, []float64{100, 55}, true},
+		}},
+		{"zero probe delta passes any change", DeadbandConfiguration{Delta: 1, ProbeDeltas: map[int]float64{1: 0}}, []step{
+			{0, []float64{100, 50}, true},
+			{time.Second, []float64{100.5, 50}, false},
+			{time.Second, []float64{100.5, 50.1}, true},
+		}},
+		{"enabled by probe delta alone", DeadbandConfiguration{ProbeDeltas: map[int]float64{0: 2}}, []step{
+			{0, []float64{100}, true},
+			{time.Second, []float64{101}, false},
+		}},
+		{"probe plugged in or unplugged", DeadbandConfiguration{Delta: 10}, []step{
+			{0, []float64{100, UnpluggedTemperature}, true},
+			{time.Second, []float64{100, 20}, true},
+			{time.Second, []float64{100, UnpluggedTemperature}, true},
+			{time.Second, []float64{100, UnpluggedTemperature}, false},
+		}},
+		{"probe count changes", DeadbandConfiguration{Delta: 1}, []step{
+			{0, []float64{100}, true},
+			{time.Second, []float64{100, 50}, true},
+		}},
+		{"max interval", DeadbandConfiguration{Delta: 1, MaxInterval: time.Minute}, []step{
+			{0, []float64{100}, true},
+			{30 * time.Second, []float64{100}, false},
+			{30 * time.Second, []float64{100}, true},
+			{59 * time.Second, []float64{100}, false},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newDeadband(test.config)
+			at := time.Unix(1600000000, 0)
+			for i, step := range test.steps {
+				at = at.Add(step.after)
+				if got := d.accept(Reading{Time: at, Temperatures: step.temperatures}); got != step.want {
+					t.Errorf("step %d: got %v, want %v", i, got, step.want)
+				}
+			}
+		})
+	}
+}
@@ -16,11 +16,62 @@
 package ibbq
 
 import (
+	"context"
+	"errors"
+	"sync"
+
 	"github.com/go-ble/ble"
 	"github.com/sworisbreathing/go-ibbq/v2/os"
 )
 
-// NewDevice creates a new device
-func NewDevice(impl string) (d ble.Device, err error) {
-	return os.DefaultDevice()
+// NewDevice creates a new device using the named implementation.
+// "default" selects the platform's default implementation.
+func NewDevice(impl string, opts ...ble.Option) (d ble.Device, err error) {
+	return os.NewDevice(impl, opts...)
+}
+
+// SharedDevice is a Bluetooth adapter shared by several Ibbqs, e.g. to monitor more than one thermometer.
+// The Ibbqs take turns to scan for their devices, and leave the adapter running when they disconnect,
+// so it must be stopped by its owner once they are all done with it.
+type SharedDevice struct {
+	ble.Device
+	connectMu sync.Mutex
+}
+
+// NewSharedDevice creates a device using the named implementation, for sharing between Ibbqs.
+func NewSharedDevice(impl string, opts ...ble.Option) (*SharedDevice, error) {
+	d, err := NewDevice(impl, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedDevice{Device: d}, nil
+}
+
+// dial scans the device for an advertisement accepted by the filter, then connects to its sender.
+func dial(ctx context.Context, d ble.Device, f ble.AdvFilter) (ble.Client, error) {
+	scanCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	found := make(chan ble.Advertisement, 1)
+	err := d.Scan(scanCtx, false, func(a ble.Advertisement) {
+		if !f(a) {
+			return
+		}
+		select {
+		case found <- a:
+			cancel()
+		default:
+		}
+	})
+	select {
+	case a := <-found:
+		return d.Dial(ctx, a.Addr())
+	default:
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err == nil {
+		err = errors.New("scan ended without finding a device")
+	}
+	return nil, err
 }
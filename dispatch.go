@@ -0,0 +1,183 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"sync"
+)
+
+// DispatchMode controls how handlers are invoked.
+type DispatchMode string
+
+const (
+	// ConcurrentDispatch invokes each handler in its own goroutine.
+	// Handlers may observe events out of order.
+	ConcurrentDispatch DispatchMode = "concurrent"
+	// SerialDispatch invokes handlers one at a time, in the order events were received.
+	SerialDispatch DispatchMode = "serial"
+)
+
+// DispatchStats reports on handler dispatch.
+type DispatchStats struct {
+	// QueueDepth is the number of events waiting to be dispatched.
+	QueueDepth int
+	// QueueCapacity is the maximum number of events which may be waiting.
+	QueueCapacity int
+	// MaxQueueDepth is the largest queue depth observed.
+	MaxQueueDepth int
+	// Dispatched is the number of events passed to handlers.
+	Dispatched uint64
+	// Dropped is the number of events discarded because the queue was full.
+	Dropped uint64
+}
+
+type dispatchItem struct {
+	name string
+	f    func()
+}
+
+// dispatcher hands events to handlers.
+// In serial mode, a single worker goroutine drains the queue, and is woken whenever an event is queued.
+// Close waits for the worker and any handlers which are running.
+type dispatcher struct {
+	mu       sync.Mutex
+	mode     DispatchMode
+	guard    *handlerGuard
+	queue    []dispatchItem
+	capacity int
+	started  bool
+	closed   bool
+	wake     chan struct{}
+	stop     chan struct{}
+	handlers sync.WaitGroup
+	stats    DispatchStats
+}
+
+func newDispatcher(mode DispatchMode, capacity int, guard *handlerGuard) *dispatcher {
+	if capacity <= 0 {
+		capacity = DefaultConfiguration.DispatchQueueSize
+	}
+	return &dispatcher{
+		mode:     mode,
+		guard:    guard,
+		capacity: capacity,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		stats:    DispatchStats{QueueCapacity: capacity},
+	}
+}
+
+func (d *dispatcher) dispatch(name string, f func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		d.stats.Dropped++
+		logger.Debug("Dispatcher is closed, dropping event", "handler", name)
+		return
+	}
+	if d.mode != SerialDispatch {
+		d.stats.Dispatched++
+		d.handlers.Add(1)
+		go func() {
+			defer d.handlers.Done()
+			d.guard.invoke(name, f)
+		}()
+		return
+	}
+	if len(d.queue) >= d.capacity {
+		// status updates and disconnects are never dropped, so that handlers always learn of them.
+		// Rather than growing the queue, only the latest of each is kept.
+		if name != statusUpdatedHandlerName && name != disconnectedHandlerName {
+			d.stats.Dropped++
+			logger.Warn("Dispatch queue is full, dropping event", "handler", name)
+			return
+		}
+		d.coalesce(name)
+	}
+	d.queue = append(d.queue, dispatchItem{name, f})
+	if len(d.queue) > d.stats.MaxQueueDepth {
+		d.stats.MaxQueueDepth = len(d.queue)
+	}
+	if !d.started {
+		d.started = true
+		d.handlers.Add(1)
+		go func() {
+			defer d.handlers.Done()
+			d.run()
+		}()
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// coalesce removes a queued event for the named handler, which a newer event supersedes.
+func (d *dispatcher) coalesce(name string) {
+	for i, item := range d.queue {
+		if item.name == name {
+			copy(d.queue[i:], d.queue[i+1:])
+			d.queue[len(d.queue)-1] = dispatchItem{}
+			d.queue = d.queue[:len(d.queue)-1]
+			d.stats.Dropped++
+			return
+		}
+	}
+}
+
+// run dispatches queued events until the dispatcher is closed and the queue is empty.
+func (d *dispatcher) run() {
+	for {
+		d.mu.Lock()
+		if len(d.queue) == 0 {
+			closed := d.closed
+			d.mu.Unlock()
+			if closed {
+				return
+			}
+			select {
+			case <-d.wake:
+			case <-d.stop:
+			}
+			continue
+		}
+		item := d.queue[0]
+		d.queue[0] = dispatchItem{}
+		d.queue = d.queue[1:]
+		d.stats.Dispatched++
+		d.mu.Unlock()
+		d.guard.invoke(item.name, item.f)
+	}
+}
+
+// close stops accepting events, and waits for queued events to be dispatched and for running handlers to return.
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.stop)
+	}
+	d.mu.Unlock()
+	d.handlers.Wait()
+}
+
+func (d *dispatcher) snapshot() DispatchStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := d.stats
+	stats.QueueDepth = len(d.queue)
+	return stats
+}
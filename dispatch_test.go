@@ -0,0 +1,182 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockedDispatcher creates a serial dispatcher whose worker is blocked in a handler until release is closed.
+func blockedDispatcher(t *testing.T, capacity int) (d *dispatcher, release chan struct{}) {
+	d = newDispatcher(SerialDispatch, capacity, newHandlerGuard(0))
+	release = make(chan struct{})
+	started := make(chan struct{})
+	d.dispatch(readingHandlerName, func() {
+		close(started)
+		<-release
+	})
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("worker didn't start")
+	}
+	return d, release
+}
+
+func TestSerialDispatchOrder(t *testing.T) {
+	d := newDispatcher(SerialDispatch, 1000, newHandlerGuard(0))
+	var got []int
+	for i := 0; i < 1000; i++ {
+		i := i
+		d.dispatch(readingHandlerName, func() { got = append(got, i) })
+	}
+	d.close()
+	for i, n := range got {
+		if n != i {
+			t.Fatalf("event %d dispatched at position %d", n, i)
+		}
+	}
+	if len(got) != 1000 {
+		t.Errorf("got %d events, want 1000", len(got))
+	}
+}
+
+func TestDispatchQueue(t *testing.T) {
+	type event struct {
+		name  string
+		value string
+	}
+	tests := []struct {
+		name       string
+		events     []event
+		want       []string
+		wantStats  DispatchStats
+		wantQueued int
+	}{
+		{"within capacity",
+			[]event{{readingHandlerName, "r1"}, {statusUpdatedHandlerName, "s1"}, {readingHandlerName, "r2"}},
+			[]string{"r1", "s1", "r2"},
+			DispatchStats{QueueCapacity: 3, MaxQueueDepth: 3, Dispatched: 4}, 3},
+		{"drops when full",
+			[]event{{readingHandlerName, "r1"}, {readingHandlerName, "r2"}, {readingHandlerName, "r3"}, {readingHandlerName, "r4"}, {batteryHandlerName, "b1"}},
+			[]string{"r1", "r2", "r3"},
+			DispatchStats{QueueCapacity: 3, MaxQueueDepth: 3, Dispatched: 4, Dropped: 2}, 3},
+		{"critical events when full",
+			[]event{{readingHandlerName, "r1"}, {readingHandlerName, "r2"}, {readingHandlerName, "r3"}, {statusUpdatedHandlerName, "s1"}, {disconnectedHandlerName, "d1"}},
+			[]string{"r1", "r2", "r3", "s1", "d1"},
+			DispatchStats{QueueCapacity: 3, MaxQueueDepth: 5, Dispatched: 6}, 5},
+		{"only the latest status is kept when full",
+			[]event{{readingHandlerName, "r1"}, {statusUpdatedHandlerName, "s1"}, {readingHandlerName, "r2"}, {statusUpdatedHandlerName, "s2"}, {statusUpdatedHandlerName, "s3"}, {readingHandlerName, "r3"}},
+			[]string{"r1", "r2", "s3"},
+			DispatchStats{QueueCapacity: 3, MaxQueueDepth: 3, Dispatched: 4, Dropped: 3}, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, release := blockedDispatcher(t, 3)
+			var mu sync.Mutex
+			var got []string
+			for _, e := range test.events {
+				value := e.value
+				d.dispatch(e.name, func() {
+					mu.Lock()
+					got = append(got, value)
+					mu.Unlock()
+				})
+			}
+			if queued := d.snapshot().QueueDepth; queued != test.wantQueued {
+				t.Errorf("got queue depth %d, want %d", queued, test.wantQueued)
+			}
+			close(release)
+			d.close()
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if stats := d.snapshot(); stats != test.wantStats {
+				t.Errorf("got %+v, want %+v", stats, test.wantStats)
+			}
+		})
+	}
+}
+
+func TestDispatcherClose(t *testing.T) {
+	for _, mode := range []DispatchMode{ConcurrentDispatch, SerialDispatch} {
+		t.Run(string(mode), func(t *testing.T) {
+			d := newDispatcher(mode, 10, newHandlerGuard(0))
+			release := make(chan struct{})
+			started := make(chan struct{})
+			returned := make(chan struct{})
+			d.dispatch(readingHandlerName, func() {
+				close(started)
+				<-release
+				close(returned)
+			})
+			<-started
+			closed := make(chan struct{})
+			go func() {
+				d.close()
+				close(closed)
+			}()
+			select {
+			case <-closed:
+				t.Fatal("close returned while a handler was running")
+			case <-time.After(20 * time.Millisecond):
+			}
+			close(release)
+			select {
+			case <-closed:
+			case <-time.After(time.Second):
+				t.Fatal("close didn't return once the handler had")
+			}
+			select {
+			case <-returned:
+			default:
+				t.Error("close returned before the handler")
+			}
+			called := false
+			d.dispatch(statusUpdatedHandlerName, func() { called = true })
+			d.close()
+			if stats := d.snapshot(); called || stats.Dispatched != 1 || stats.Dropped != 1 {
+				t.Errorf("got %+v after dispatching to a closed dispatcher", stats)
+			}
+		})
+	}
+}
+
+func TestCloseWaitsForHandlers(t *testing.T) {
+	d := &fakeDevice{}
+	bbq, _ := newTestIbbq(t, context.Background(), d, SerialDispatch)
+	var mu sync.Mutex
+	var statuses []Status
+	bbq.statusUpdatedHandler = func(status Status) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		statuses = append(statuses, status)
+		mu.Unlock()
+	}
+	if err := bbq.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	bbq.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(statuses) == 0 || statuses[len(statuses)-1] != Disconnected {
+		t.Errorf("got statuses %v when Close returned, want them to end with %v", statuses, Disconnected)
+	}
+}
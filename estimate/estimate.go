@@ -0,0 +1,375 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package estimate predicts when each probe will reach its target temperature.
+//
+// Meat heats according to Newton's law of heating: its temperature approaches the cooker's temperature
+// exponentially, T(t) = Tc - (Tc - T0)e^(-kt). Rather than extrapolating linearly, which badly underestimates
+// the time remaining late in a cook, we fit k over a sliding window of readings and solve for the target.
+package estimate
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+// Configuration configures an Estimator.
+type Configuration struct {
+	// Targets maps probe indexes to target temperatures, in celsius.
+	Targets map[int]float64
+	// AmbientProbe is the index of the probe measuring the cooker's temperature, or -1 if there isn't one.
+	// Without an ambient probe, the cooker's temperature is estimated from the shape of the heating curve.
+	AmbientProbe int
+	// Window is how much history the curve is fitted over.
+	Window time.Duration
+	// SampleInterval is the minimum time between the samples used for fitting.
+	SampleInterval time.Duration
+	// MinSamples is the number of samples required before an estimate is made.
+	MinSamples int
+	// Confidence is the width of the confidence band, in standard errors.
+	Confidence float64
+	// Suppressor, if set, stops samples being taken while it reports readings as suppressed,
+	// e.g. while the cooker's lid is open.
+	Suppressor ibbq.Suppressor
+}
+
+// DefaultConfiguration is a somewhat sane default.
+var DefaultConfiguration = Configuration{
+	AmbientProbe:   -1,
+	Window:         45 * time.Minute,
+	SampleInterval: 30 * time.Second,
+	MinSamples:     10,
+	Confidence:     1.96,
+}
+
+// Estimate is the predicted time at which a probe reaches its target temperature.
+type Estimate struct {
+	// Probe is the index of the probe.
+	Probe int
+	// Time is when the estimate was made.
+	Time time.Time
+	// Temperature is the probe's temperature when the estimate was made, in celsius.
+	Temperature float64
+	// Target is the probe's target temperature, in celsius.
+	Target float64
+	// Reached is set once the probe has reached its target.
+	Reached bool
+	// ETA is the most likely time at which the probe reaches its target.
+	ETA time.Time
+	// Earliest and Latest bound the ETA. Latest is the zero time when no upper bound can be given.
+	Earliest time.Time
+	Latest   time.Time
+}
+
+// Remaining returns the most likely time remaining until the probe reaches its target.
+func (e Estimate) Remaining() time.Duration {
+	if e.Reached {
+		return 0
+	}
+	return e.ETA.Sub(e.Time)
+}
+
+// Handler is a callback for new estimates.
+type Handler func(Estimate)
+
+type sample struct {
+	time        time.Time
+	temperature float64
+	ambient     float64
+}
+
+// Estimator predicts when probes will reach their targets. It is safe for concurrent use.
+type Estimator struct {
+	mu        sync.Mutex
+	config    Configuration
+	handler   Handler
+	samples   map[int][]sample
+	estimates map[int]Estimate
+}
+
+// NewEstimator creates an estimator. The handler, which may be nil, is called with each new estimate.
+func NewEstimator(config Configuration, handler Handler) *Estimator {
+	targets := map[int]float64{}
+	for probe, target := range config.Targets {
+		targets[probe] = target
+	}
+	config.Targets = targets
+	return &Estimator{
+		config:    config,
+		handler:   handler,
+		samples:   map[int][]sample{},
+		estimates: map[int]Estimate{},
+	}
+}
+
+// SetTarget sets a probe's target temperature, in celsius.
+func (e *Estimator) SetTarget(probe int, target float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config.Targets[probe] = target
+	delete(e.estimates, probe)
+}
+
+// ClearTarget stops estimating for a probe.
+func (e *Estimator) ClearTarget(probe int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.config.Targets, probe)
+	delete(e.estimates, probe)
+}
+
+// Update feeds a reading to the estimator. It is meant to be called from a reading handler.
+func (e *Estimator) Update(reading ibbq.Reading) {
+	if e.config.Suppressor != nil && e.config.Suppressor.Suppressed() {
+		return
+	}
+	var estimates []Estimate
+	e.mu.Lock()
+	ambient := math.NaN()
+	if e.config.AmbientProbe >= 0 && e.config.AmbientProbe < len(reading.Temperatures) &&
+		ibbq.ProbeConnected(reading.Temperatures[e.config.AmbientProbe]) {
+		ambient = reading.Temperatures[e.config.AmbientProbe]
+	}
+	for probe, target := range e.config.Targets {
+		if probe >= len(reading.Temperatures) || !ibbq.ProbeConnected(reading.Temperatures[probe]) {
+			delete(e.samples, probe)
+			delete(e.estimates, probe)
+			continue
+		}
+		if !e.addSample(probe, sample{reading.Time, reading.Temperatures[probe], ambient}) {
+			continue
+		}
+		if estimate, ok := e.estimate(probe, target); ok {
+			e.estimates[probe] = estimate
+			estimates = append(estimates, estimate)
+		}
+	}
+	handler := e.handler
+	e.mu.Unlock()
+	if handler != nil {
+		sort.Slice(estimates, func(i, j int) bool { return estimates[i].Probe < estimates[j].Probe })
+		for _, estimate := range estimates {
+			handler(estimate)
+		}
+	}
+}
+
+// Estimate returns the latest estimate for a probe, if there is one.
+func (e *Estimator) Estimate(probe int) (Estimate, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	estimate, ok := e.estimates[probe]
+	return estimate, ok
+}
+
+// Estimates returns the latest estimates for all probes, ordered by probe.
+func (e *Estimator) Estimates() []Estimate {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	estimates := make([]Estimate, 0, len(e.estimates))
+	for _, estimate := range e.estimates {
+		estimates = append(estimates, estimate)
+	}
+	sort.Slice(estimates, func(i, j int) bool { return estimates[i].Probe < estimates[j].Probe })
+	return estimates
+}
+
+// addSample records a sample, dropping samples which have left the window.
+// It reports whether the sample was taken.
+func (e *Estimator) addSample(probe int, s sample) bool {
+	samples := e.samples[probe]
+	if len(samples) > 0 && s.time.Sub(samples[len(samples)-1].time) < e.config.SampleInterval {
+		return false
+	}
+	samples = append(samples, s)
+	start := 0
+	for start < len(samples) && s.time.Sub(samples[start].time) > e.config.Window {
+		start++
+	}
+	e.samples[probe] = append(samples[:0], samples[start:]...)
+	return true
+}
+
+// estimate fits the heating curve to a probe's samples and solves for its target.
+func (e *Estimator) estimate(probe int, target float64) (Estimate, bool) {
+	samples := e.samples[probe]
+	latest := samples[len(samples)-1]
+	estimate := Estimate{
+		Probe:       probe,
+		Time:        latest.time,
+		Temperature: latest.temperature,
+		Target:      target,
+	}
+	if latest.temperature >= target {
+		estimate.Reached = true
+		estimate.ETA = latest.time
+		estimate.Earliest = latest.time
+		estimate.Latest = latest.time
+		return estimate, true
+	}
+	if len(samples) < e.config.MinSamples {
+		return estimate, false
+	}
+	cooker, ok := cookerTemperature(samples)
+	if !ok {
+		cooker, ok = fitCookerTemperature(samples)
+	}
+	if !ok || cooker <= target {
+		return estimate, false
+	}
+	f, ok := fitRate(samples, cooker)
+	if !ok || f.rate <= 0 {
+		return estimate, false
+	}
+	minutesAt := func(rate float64) float64 {
+		return (math.Log(cooker-latest.temperature) - math.Log(cooker-target)) / rate
+	}
+	at := func(minutes float64) time.Time {
+		return latest.time.Add(time.Duration(minutes * float64(time.Minute)))
+	}
+	estimate.ETA = at(minutesAt(f.rate))
+	estimate.Earliest = at(minutesAt(f.rate + e.config.Confidence*f.stdErr))
+	if slowest := f.rate - e.config.Confidence*f.stdErr; slowest > 0 {
+		estimate.Latest = at(minutesAt(slowest))
+	}
+	return estimate, true
+}
+
+// cookerTemperature averages the ambient probe's temperature over the samples.
+func cookerTemperature(samples []sample) (float64, bool) {
+	total := 0.0
+	for _, s := range samples {
+		if math.IsNaN(s.ambient) {
+			return 0, false
+		}
+		total += s.ambient
+	}
+	return total / float64(len(samples)), true
+}
+
+// fitCookerTemperature finds the cooker temperature which best explains the shape of the heating curve.
+func fitCookerTemperature(samples []sample) (float64, bool) {
+	hottest := samples[0].temperature
+	for _, s := range samples {
+		hottest = math.Max(hottest, s.temperature)
+	}
+	best, bestErr := 0.0, math.Inf(1)
+	for cooker := math.Floor(hottest) + 1; cooker <= hottest+250; cooker++ {
+		f, ok := fitRate(samples, cooker)
+		if !ok || f.rate <= 0 {
+			continue
+		}
+		if sse := f.temperatureError(samples, cooker); sse < bestErr {
+			best, bestErr = cooker, sse
+		}
+	}
+	return best, !math.IsInf(bestErr, 1)
+}
+
+// fit is the result of fitting ln(cooker - T) = intercept - rate * minutes.
+type fit struct {
+	start     time.Time
+	intercept float64
+	rate      float64
+	stdErr    float64
+}
+
+// fitRate fits the heating rate constant by linear regression, given the cooker temperature.
+func fitRate(samples []sample, cooker float64) (fit, bool) {
+	n := float64(len(samples))
+	if n < 3 {
+		return fit{}, false
+	}
+	start := samples[0].time
+	var sumX, sumY float64
+	xs := make([]float64, len(samples))
+	ys := make([]float64, len(samples))
+	for i, s := range samples {
+		if s.temperature >= cooker {
+			return fit{}, false
+		}
+		xs[i] = s.time.Sub(start).Minutes()
+		ys[i] = math.Log(cooker - s.temperature)
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var sxx, sxy float64
+	for i := range xs {
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+	}
+	if sxx == 0 {
+		return fit{}, false
+	}
+	slope := sxy / sxx
+	intercept := meanY - slope*meanX
+	var sse float64
+	for i := range xs {
+		residual := ys[i] - (intercept + slope*xs[i])
+		sse += residual * residual
+	}
+	return fit{
+		start:     start,
+		intercept: intercept,
+		rate:      -slope,
+		stdErr:    math.Sqrt(sse/(n-2)) / math.Sqrt(sxx),
+	}, true
+}
+
+// temperatureError is the sum of squared differences between the fitted curve and the samples, in celsius.
+func (f fit) temperatureError(samples []sample, cooker float64) float64 {
+	var sse float64
+	for _, s := range samples {
+		predicted := cooker - math.Exp(f.intercept-f.rate*s.time.Sub(f.start).Minutes())
+		sse += (s.temperature - predicted) * (s.temperature - predicted)
+	}
+	return sse
+}
+
+// ParseTargets parses target temperatures given as a comma separated list of probe=temperature pairs,
+// e.g. "1=93,2=74". Probes are numbered from 1, as on the device, and temperatures are in celsius.
+// The returned map is keyed by probe index, i.e. starting from 0.
+func ParseTargets(s string) (map[int]float64, error) {
+	targets := map[int]float64{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid target %q: expected probe=temperature", pair)
+		}
+		probe, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil || probe < 1 {
+			return nil, fmt.Errorf("invalid probe in target %q", pair)
+		}
+		target, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid temperature in target %q", pair)
+		}
+		targets[probe-1] = target
+	}
+	return targets, nil
+}
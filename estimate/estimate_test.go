@@ -0,0 +1,166 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package estimate
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+type suppressor bool
+
+func (s suppressor) Suppressed() bool { return bool(s) }
+
+// heating returns the temperature of meat starting at 20°C in a 120°C cooker, after the given number of minutes.
+func heating(minutes float64) float64 {
+	return 120 - 100*math.Exp(-0.02*minutes)
+}
+
+func TestEstimator(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	// the time at which heating reaches 90°C
+	reached := start.Add(time.Duration(math.Log(100.0/30) / 0.02 * float64(time.Minute)))
+	tests := []struct {
+		name     string
+		change   func(c *Configuration)
+		minutes  float64
+		reading  func(minutes float64) []float64
+		want     bool
+		wantETA  time.Time
+		reached  bool
+		tolerate time.Duration
+	}{
+		{"ambient probe", func(c *Configuration) { c.AmbientProbe = 1 }, 20,
+			func(m float64) []float64 { return []float64{heating(m), 120} }, true, reached, false, time.Second},
+		{"fitted cooker temperature", func(c *Configuration) {}, 20,
+			func(m float64) []float64 { return []float64{heating(m), ibbq.UnpluggedTemperature} }, true, reached, false, time.Minute},
+		{"unplugged ambient probe", func(c *Configuration) { c.AmbientProbe = 1 }, 20,
+			func(m float64) []float64 { return []float64{heating(m), ibbq.UnpluggedTemperature} }, true, reached, false, time.Minute},
+		{"too few samples", func(c *Configuration) { c.MinSamples = 100 }, 20,
+			func(m float64) []float64 { return []float64{heating(m)} }, false, time.Time{}, false, 0},
+		{"target reached", func(c *Configuration) {}, 70,
+			func(m float64) []float64 { return []float64{heating(m)} }, true, start.Add(70 * time.Minute), true, 0},
+		{"cooker not hot enough", func(c *Configuration) { c.AmbientProbe = 1 }, 20,
+			func(m float64) []float64 { return []float64{heating(m), 85} }, false, time.Time{}, false, 0},
+		{"not heating", func(c *Configuration) {}, 20,
+			func(m float64) []float64 { return []float64{50} }, false, time.Time{}, false, 0},
+		{"unplugged", func(c *Configuration) {}, 20,
+			func(m float64) []float64 { return []float64{ibbq.UnpluggedTemperature} }, false, time.Time{}, false, 0},
+		{"suppressed", func(c *Configuration) { c.Suppressor = suppressor(true) }, 20,
+			func(m float64) []float64 { return []float64{heating(m)} }, false, time.Time{}, false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfiguration
+			config.Targets = map[int]float64{0: 90}
+			test.change(&config)
+			var handled []Estimate
+			estimator := NewEstimator(config, func(estimate Estimate) { handled = append(handled, estimate) })
+			for seconds := 0.0; seconds <= test.minutes*60; seconds += 10 {
+				minutes := seconds / 60
+				estimator.Update(ibbq.Reading{
+					Time:         start.Add(time.Duration(seconds) * time.Second),
+					Temperatures: test.reading(minutes),
+				})
+			}
+			estimate, ok := estimator.Estimate(0)
+			if ok != test.want {
+				t.Fatalf("got estimate %v, want %v", ok, test.want)
+			}
+			if !ok {
+				if len(handled) != 0 {
+					t.Errorf("handler called with %+v", handled)
+				}
+				return
+			}
+			if len(handled) == 0 || handled[len(handled)-1] != estimate {
+				t.Errorf("handler wasn't called with the latest estimate")
+			}
+			if estimate.Reached != test.reached {
+				t.Errorf("got reached %v, want %v", estimate.Reached, test.reached)
+			}
+			if diff := estimate.ETA.Sub(test.wantETA); diff < -test.tolerate || diff > test.tolerate {
+				t.Errorf("got ETA %v, want %v", estimate.ETA, test.wantETA)
+			}
+			if estimate.Earliest.After(estimate.ETA) || (!estimate.Latest.IsZero() && estimate.Latest.Before(estimate.ETA)) {
+				t.Errorf("ETA %v isn't between %v and %v", estimate.ETA, estimate.Earliest, estimate.Latest)
+			}
+		})
+	}
+}
+
+func TestSamplesAreWindowed(t *testing.T) {
+	config := DefaultConfiguration
+	config.Targets = map[int]float64{0: 90}
+	config.Window = 10 * time.Minute
+	estimator := NewEstimator(config, nil)
+	start := time.Unix(1600000000, 0)
+	for seconds := 0; seconds <= 30*60; seconds += 10 {
+		estimator.Update(ibbq.Reading{Time: start.Add(time.Duration(seconds) * time.Second), Temperatures: []float64{heating(float64(seconds) / 60)}})
+	}
+	samples := estimator.samples[0]
+	if want := 21; len(samples) != want {
+		t.Errorf("got %d samples, want %d", len(samples), want)
+	}
+	if first := samples[0].time; first != start.Add(20*time.Minute) {
+		t.Errorf("got first sample at %v, want %v", first, start.Add(20*time.Minute))
+	}
+}
+
+func TestClearTarget(t *testing.T) {
+	config := DefaultConfiguration
+	config.Targets = map[int]float64{0: 50}
+	estimator := NewEstimator(config, nil)
+	estimator.Update(ibbq.Reading{Time: time.Now(), Temperatures: []float64{60}})
+	if _, ok := estimator.Estimate(0); !ok {
+		t.Fatal("no estimate for a probe which has reached its target")
+	}
+	estimator.ClearTarget(0)
+	if estimates := estimator.Estimates(); len(estimates) != 0 {
+		t.Errorf("got %+v after clearing the target", estimates)
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[int]float64
+		wantErr bool
+	}{
+		{"", map[int]float64{}, false},
+		{"1=93", map[int]float64{0: 93}, false},
+		{" 1 = 93.5 , 3=74,", map[int]float64{0: 93.5, 2: 74}, false},
+		{"1", nil, true},
+		{"0=93", nil, true},
+		{"a=93", nil, true},
+		{"1=hot", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := ParseTargets(test.in)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -17,12 +17,15 @@ package main
 
 import (
 	"context"
+	"flag"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-ble/ble"
 	"github.com/mgutz/logxi/v1"
 	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/recorder"
 )
 
 var logger = log.New("main")
@@ -45,8 +48,36 @@ func disconnectedHandler(cancel func(), done chan struct{}) func() {
 	}
 }
 
+// newRecorder creates a recorder from the command line flags, or returns nil if no recording file was given.
+func newRecorder(path, format, probes string, rotateSize int64, rotateDaily bool, syncInterval time.Duration) (*recorder.Recorder, error) {
+	if path == "" {
+		return nil, nil
+	}
+	config := recorder.DefaultConfiguration
+	config.Path = path
+	config.Format = recorder.Format(format)
+	if probes != "" {
+		config.ProbeNames = strings.Split(probes, ",")
+	}
+	config.MaxSize = rotateSize * 1024 * 1024
+	config.Daily = rotateDaily
+	config.SyncInterval = syncInterval
+	return recorder.NewRecorder(config)
+}
+
 func main() {
+	record := flag.String("record", "", "file to record readings to (none if empty)")
+	format := flag.String("format", string(recorder.CSV), "recording format ('csv' or 'jsonl')")
+	probes := flag.String("probes", "", "comma-separated probe names for the recording, e.g. 'pit,flat,point'")
+	rotateSize := flag.Int64("rotate-size", 0, "size in megabytes at which the recording is rotated (0 to disable)")
+	rotateDaily := flag.Bool("rotate-daily", false, "rotate the recording at midnight")
+	syncInterval := flag.Duration("sync", recorder.DefaultConfiguration.SyncInterval, "longest time between syncing the recording to disk")
+	flag.Parse()
 	var err error
+	var rec *recorder.Recorder
+	if rec, err = newRecorder(*record, *format, *probes, *rotateSize, *rotateDaily, *syncInterval); err != nil {
+		logger.Fatal("Error opening recording", "err", err)
+	}
 	logger.Debug("initializing context")
 	ctx1, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -60,9 +91,13 @@ func main() {
 	if config, err = ibbq.NewConfiguration(60*time.Second, 5*time.Minute); err != nil {
 		logger.Fatal("Error creating configuration", "err", err)
 	}
+	config.DispatchMode = ibbq.SerialDispatch
 	if bbq, err = ibbq.NewIbbq(ctx, config, disconnectedHandler(cancel, done), temperatureReceived, batteryLevelReceived, statusUpdated); err != nil {
 		logger.Fatal("Error creating iBBQ", "err", err)
 	}
+	if rec != nil {
+		bbq.SetReadingHandler(rec.Update)
+	}
 	logger.Debug("instantiated ibbq struct")
 	logger.Info("Connecting to device")
 	if err = bbq.Connect(); err != nil {
@@ -71,5 +106,11 @@ func main() {
 	logger.Info("Connected to device")
 	<-ctx.Done()
 	<-done
+	bbq.Close()
+	if rec != nil {
+		if err = rec.Close(); err != nil {
+			logger.Error("Error closing recording", "err", err)
+		}
+	}
 	logger.Info("Exiting")
 }
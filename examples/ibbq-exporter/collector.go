@@ -0,0 +1,180 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+var (
+	temperatureDesc = prometheus.NewDesc("ibbq_probe_temperature_celsius",
+		"Temperature of each plugged-in probe.", []string{"address", "probe", "name"}, nil)
+	batteryPercentDesc = prometheus.NewDesc("ibbq_battery_percent",
+		"Battery level as a percentage.", []string{"address"}, nil)
+	batteryVoltageDesc = prometheus.NewDesc("ibbq_battery_voltage_volts",
+		"Battery voltage.", []string{"address"}, nil)
+	connectedDesc = prometheus.NewDesc("ibbq_connected",
+		"Whether the thermometer is connected (1) or not (0).", []string{"address"}, nil)
+	rssiDesc = prometheus.NewDesc("ibbq_rssi_dbm",
+		"Received signal strength of the connection.", []string{"address"}, nil)
+	readingAgeDesc = prometheus.NewDesc("ibbq_last_reading_age_seconds",
+		"Time since the last temperature reading was received.", []string{"address"}, nil)
+	reconnectsDesc = prometheus.NewDesc("ibbq_reconnects_total",
+		"Number of times the connection has been re-established after being lost.", []string{"address"}, nil)
+)
+
+// collector serves the latest state of each thermometer, read when scraped.
+type collector struct {
+	names   []string
+	devices []*device
+}
+
+func newCollector(names []string) *collector {
+	return &collector{names: names}
+}
+
+// add adds a thermometer, by address. An empty address monitors the first thermometer found.
+func (c *collector) add(address string) *device {
+	d := &device{address: address}
+	c.devices = append(c.devices, d)
+	return d
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- temperatureDesc
+	ch <- batteryPercentDesc
+	ch <- batteryVoltageDesc
+	ch <- connectedDesc
+	ch <- rssiDesc
+	ch <- readingAgeDesc
+	ch <- reconnectsDesc
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	for _, d := range c.devices {
+		c.collect(ch, d.snapshot())
+	}
+}
+
+func (c *collector) collect(ch chan<- prometheus.Metric, s snapshot) {
+	connected := 0.0
+	if s.status == ibbq.Connected {
+		connected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(connectedDesc, prometheus.GaugeValue, connected, s.address)
+	ch <- prometheus.MustNewConstMetric(reconnectsDesc, prometheus.CounterValue, float64(s.reconnects), s.address)
+	if s.reading != nil {
+		ch <- prometheus.MustNewConstMetric(readingAgeDesc, prometheus.GaugeValue,
+			time.Since(s.reading.Time).Seconds(), s.address)
+		// only while connected, so that a lost thermometer's temperatures don't look current
+		if s.status == ibbq.Connected {
+			for probe, temperature := range s.reading.Temperatures {
+				if ibbq.ProbeConnected(temperature) {
+					ch <- prometheus.MustNewConstMetric(temperatureDesc, prometheus.GaugeValue, temperature,
+						s.address, strconv.Itoa(probe+1), c.probeName(probe))
+				}
+			}
+		}
+	}
+	if s.battery != nil {
+		ch <- prometheus.MustNewConstMetric(batteryPercentDesc, prometheus.GaugeValue, float64(s.battery.Percent), s.address)
+		ch <- prometheus.MustNewConstMetric(batteryVoltageDesc, prometheus.GaugeValue, float64(s.battery.Voltage)/1000, s.address)
+	}
+	if s.signalStrength != nil && s.status == ibbq.Connected {
+		ch <- prometheus.MustNewConstMetric(rssiDesc, prometheus.GaugeValue, float64(s.signalStrength.RSSI), s.address)
+	}
+}
+
+func (c *collector) probeName(probe int) string {
+	if probe < len(c.names) && c.names[probe] != "" {
+		return c.names[probe]
+	}
+	return "probe" + strconv.Itoa(probe+1)
+}
+
+// device is a thermometer kept connected by a reconnector. The latest values are kept across reconnections.
+type device struct {
+	address     string
+	reconnector *ibbq.Reconnector
+
+	mu             sync.Mutex
+	lastAddress    string
+	reading        *ibbq.Reading
+	battery        *ibbq.Battery
+	signalStrength *ibbq.SignalStrength
+}
+
+type snapshot struct {
+	address        string
+	status         ibbq.Status
+	reconnects     int
+	reading        *ibbq.Reading
+	battery        *ibbq.Battery
+	signalStrength *ibbq.SignalStrength
+}
+
+// run keeps the thermometer connected until the context is done.
+func (d *device) run(ctx context.Context, config ibbq.Configuration) {
+	d.mu.Lock()
+	d.reconnector = ibbq.NewReconnector(func(ctx context.Context) (*ibbq.Ibbq, error) {
+		bbq, err := ibbq.NewIbbq(ctx, config, nil, nil, nil, func(status ibbq.Status) {
+			logger.Info("Status updated", "address", config.Address, "status", status)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &bbq, nil
+	})
+	d.mu.Unlock()
+	d.reconnector.Run(ctx)
+}
+
+// snapshot reads the current state, remembering the latest values in case the connection is lost.
+func (d *device) snapshot() snapshot {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := snapshot{address: d.address, status: ibbq.Disconnected}
+	if d.reconnector == nil {
+		return s
+	}
+	s.reconnects = d.reconnector.Reconnects()
+	if bbq := d.reconnector.Current(); bbq != nil {
+		s.status = bbq.Status()
+		if address := bbq.Address(); address != "" {
+			d.lastAddress = address
+		}
+		if reading, ok := bbq.LastReading(); ok {
+			d.reading = &reading
+		}
+		if battery, ok := bbq.LastBattery(); ok {
+			d.battery = &battery
+		}
+		if signalStrength, ok := bbq.LastSignalStrength(); ok {
+			d.signalStrength = &signalStrength
+		}
+	}
+	if s.address == "" {
+		s.address = d.lastAddress
+	}
+	s.reading, s.battery, s.signalStrength = d.reading, d.battery, d.signalStrength
+	return s
+}
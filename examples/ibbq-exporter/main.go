@@ -0,0 +1,97 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	log "github.com/mgutz/logxi/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+var logger = log.New("main")
+
+func main() {
+	listen := flag.String("listen", ":9102", "Address to serve metrics on")
+	devices := flag.String("devices", "", "Comma-separated addresses of the thermometers to monitor (the first one found if empty)")
+	probes := flag.String("probes", "", "Comma-separated probe names, in probe order (e.g. 'pit,brisket')")
+	deviceID := flag.Int("device-id", -1, "HCI device index of the Bluetooth adapter (-1 for the default)")
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registerInterruptHandler(cancel)
+
+	var opts []ble.Option
+	if *deviceID >= 0 {
+		opts = append(opts, ble.OptDeviceID(*deviceID))
+	}
+	shared, err := ibbq.NewSharedDevice("default", opts...)
+	if err != nil {
+		logger.Fatal("Error creating device", "err", err)
+	}
+	config := ibbq.DefaultConfiguration
+	config.SharedDevice = shared
+
+	var names []string
+	if *probes != "" {
+		names = strings.Split(*probes, ",")
+	}
+	addresses := []string{""}
+	if *devices != "" {
+		addresses = strings.Split(*devices, ",")
+	}
+	collector := newCollector(names)
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		d := collector.add(strings.TrimSpace(address))
+		deviceConfig := config
+		deviceConfig.Address = d.address
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.run(ctx, deviceConfig)
+		}()
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: *listen}
+	go func() {
+		logger.Info("Serving metrics", "addr", *listen)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Error serving metrics", "err", err)
+			cancel()
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	server.Shutdown(shutdownCtx)
+	wg.Wait()
+	shared.Stop()
+	logger.Info("Exiting")
+}
@@ -0,0 +1,300 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// publishTimeout bounds how long the broker has to acknowledge a message before it is retried.
+const publishTimeout = 10 * time.Second
+
+type message struct {
+	topic    string
+	retained bool
+	payload  string
+	// state is set for retained state, such as availability and discovery config, which is never dropped
+	// when the buffer is full. Only the latest state for each topic is kept.
+	state bool
+}
+
+type subscription struct {
+	topic   string
+	handler func(payload string)
+}
+
+// bridge publishes messages to the broker in the background, so that the thermometer's handlers never wait for it.
+// Messages are queued while the broker is unreachable, and published in order once it is back.
+type bridge struct {
+	config MQTTConfiguration
+	client mqtt.Client
+
+	mu            sync.Mutex
+	connected     bool
+	queue         []message
+	dropped       int
+	onConnect     []func()
+	subscriptions []subscription
+	wake          chan struct{}
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+	connectDone   chan struct{}
+}
+
+func newBridge(config MQTTConfiguration) (*bridge, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &bridge{
+		config:      config,
+		wake:        make(chan struct{}, 1),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		connectDone: make(chan struct{}),
+	}
+	opts := mqtt.NewClientOptions().AddBroker(config.Broker).SetClientID(config.ClientID)
+	opts.SetKeepAlive(time.Duration(config.KeepAlive) * time.Second)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(time.Duration(config.MaxReconnectInterval) * time.Second)
+	opts.SetWill(b.availabilityTopic(), "offline", byte(config.QoS), true)
+	if config.Username != "" {
+		opts.SetUsername(config.Username)
+		opts.SetPassword(config.Password)
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	opts.SetOnConnectHandler(func(mqtt.Client) {
+		logger.Info("MQTT broker", "status", "connected")
+		// ahead of anything queued while we were away, as it replaces the last will
+		b.mu.Lock()
+		b.removeState(b.availabilityTopic())
+		b.queue = append([]message{{b.availabilityTopic(), true, "online", true}}, b.queue...)
+		b.connected = true
+		onConnect := append([]func(){}, b.onConnect...)
+		subscriptions := append([]subscription{}, b.subscriptions...)
+		b.mu.Unlock()
+		b.signal()
+		// the broker may have forgotten our subscriptions and retained messages while we were away
+		for _, s := range subscriptions {
+			b.subscribe(s)
+		}
+		for _, f := range onConnect {
+			f()
+		}
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		logger.Warn("MQTT broker", "status", "connection lost", "err", err)
+		b.mu.Lock()
+		b.connected = false
+		b.mu.Unlock()
+	})
+	b.client = mqtt.NewClient(opts)
+	return b, nil
+}
+
+func (b *bridge) availabilityTopic() string {
+	return b.config.Topic + "/availability"
+}
+
+// addOnConnect registers a function to call whenever the broker is connected to, e.g. to republish retained state
+// which a broker without persistence has lost. It should be called before start.
+func (b *bridge) addOnConnect(f func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onConnect = append(b.onConnect, f)
+}
+
+// addSubscription subscribes to a topic whenever the broker is connected to. It should be called before start.
+func (b *bridge) addSubscription(topic string, handler func(payload string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = append(b.subscriptions, subscription{topic, handler})
+}
+
+func (b *bridge) subscribe(s subscription) {
+	token := b.client.Subscribe(s.topic, byte(b.config.QoS), func(_ mqtt.Client, m mqtt.Message) {
+		s.handler(string(m.Payload()))
+	})
+	go func() {
+		if !token.WaitTimeout(publishTimeout) || token.Error() != nil {
+			logger.Warn("Error subscribing", "topic", s.topic, "err", token.Error())
+		}
+	}()
+}
+
+// start connects to the broker, retrying until it succeeds or the bridge is closed, and starts publishing.
+// Once connected, the client reconnects by itself.
+func (b *bridge) start() {
+	go func() {
+		defer close(b.connectDone)
+		delay := time.Second
+		for {
+			logger.Info("MQTT broker", "status", "connecting", "broker", b.config.Broker)
+			token := b.client.Connect()
+			for !token.WaitTimeout(time.Second) {
+				if b.ctx.Err() != nil {
+					return
+				}
+			}
+			if token.Error() == nil {
+				break
+			}
+			logger.Error("Error connecting to MQTT broker, will retry", "delay", delay, "err", token.Error())
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > time.Duration(b.config.MaxReconnectInterval)*time.Second {
+				delay = time.Duration(b.config.MaxReconnectInterval) * time.Second
+			}
+		}
+	}()
+	go b.run()
+}
+
+// publish queues a message. Readings are retained only if configured, while status is always retained.
+// Retained messages replace any queued for the same topic, and aren't dropped when the buffer is full.
+func (b *bridge) publish(topic string, retained bool, payload string) {
+	b.mu.Lock()
+	if retained {
+		b.removeState(topic)
+	}
+	b.queue = append(b.queue, message{topic, retained || b.config.Retain, payload, retained})
+	if excess := len(b.queue) - b.config.BufferSize; b.config.BufferSize > 0 && excess > 0 {
+		kept := b.queue[:0]
+		for _, m := range b.queue {
+			if excess > 0 && !m.state {
+				excess--
+				b.dropped++
+				continue
+			}
+			kept = append(kept, m)
+		}
+		b.queue = kept
+	}
+	b.mu.Unlock()
+	b.signal()
+}
+
+// removeState removes the queued state for a topic, which newer state supersedes.
+func (b *bridge) removeState(topic string) {
+	for i, m := range b.queue {
+		if m.state && m.topic == topic {
+			b.queue = append(b.queue[:i], b.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// publishJSON queues a value encoded as JSON.
+func (b *bridge) publishJSON(topic string, value interface{}) {
+	m, err := json.Marshal(value)
+	if err != nil {
+		logger.Error("Can't encode to JSON", "topic", topic, "err", err)
+		return
+	}
+	b.publish(topic, false, string(m))
+}
+
+func (b *bridge) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes queued messages one at a time, keeping each one queued until the broker has acknowledged it.
+func (b *bridge) run() {
+	defer close(b.done)
+	retry := time.NewTicker(time.Second)
+	defer retry.Stop()
+	for {
+		b.mu.Lock()
+		if b.dropped > 0 {
+			logger.Warn("MQTT buffer full, dropped oldest messages", "dropped", b.dropped)
+			b.dropped = 0
+		}
+		var next *message
+		if len(b.queue) > 0 && b.connected {
+			next = &b.queue[0]
+		}
+		b.mu.Unlock()
+		if next == nil {
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-b.wake:
+			case <-retry.C:
+			}
+			continue
+		}
+		m := *next
+		token := b.client.Publish(m.topic, byte(b.config.QoS), m.retained, m.payload)
+		if !token.WaitTimeout(publishTimeout) || token.Error() != nil {
+			logger.Warn("Error publishing, will retry", "topic", m.topic, "err", token.Error())
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-retry.C:
+			}
+			continue
+		}
+		b.mu.Lock()
+		// reconnecting may have put a message ahead of the one we published
+		for i := range b.queue {
+			if b.queue[i] == m {
+				b.queue = append(b.queue[:i], b.queue[i+1:]...)
+				break
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// close publishes the bridge going offline, waiting briefly for what's queued, and disconnects.
+func (b *bridge) close() {
+	b.publish(b.availabilityTopic(), true, "offline")
+	deadline := time.Now().Add(publishTimeout)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		waiting := b.connected && len(b.queue) > 0
+		b.mu.Unlock()
+		if !waiting {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	b.cancel()
+	<-b.done
+	<-b.connectDone
+	if b.client.IsConnected() {
+		b.client.Disconnect(250)
+	}
+}
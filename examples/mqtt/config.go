@@ -0,0 +1,143 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+// Configuration is our app configuration
+type Configuration struct {
+	IbbqConfiguration
+	MQTTConfiguration
+	Targets         string `description:"Target temperatures in celsius, by probe number (e.g. '1=93,2=74')"`
+	AmbientProbe    int    `description:"Number of the probe measuring the cooker's temperature (0 if there isn't one)"`
+	Probes          string `description:"Comma-separated probe names for Home Assistant (e.g. 'pit,flat,point')"`
+	DiscoveryPrefix string `description:"Home Assistant MQTT discovery prefix (empty to disable discovery)"`
+}
+
+// DefaultConfiguration is a somewhat sane set of default values.
+var DefaultConfiguration = &Configuration{
+	IbbqConfiguration: IbbqConfiguration{
+		ConnectTimeout:         int(ibbq.DefaultConfiguration.ConnectTimeout / time.Second),
+		BatteryPollingInterval: int(ibbq.DefaultConfiguration.BatteryPollingInterval / time.Second),
+		DeviceID:               ibbq.DefaultConfiguration.DeviceID,
+		SamplingMode:           string(ibbq.DefaultConfiguration.SamplingMode),
+		SamplingInterval:       int(ibbq.DefaultConfiguration.SamplingInterval / time.Second),
+	},
+	MQTTConfiguration: MQTTConfiguration{
+		Broker:               "tcp://localhost:1883",
+		ClientID:             "go_ibbq",
+		Topic:                "home/iBBQ",
+		KeepAlive:            30,
+		MaxReconnectInterval: 60,
+		BufferSize:           10000,
+	},
+	DiscoveryPrefix: "homeassistant",
+}
+
+// IbbqConfiguration is our ibbq configuration
+type IbbqConfiguration struct {
+	Address                string `description:"Address of the thermometer (the first one found if empty)"`
+	ConnectTimeout         int    `description:"Connect timeout (in seconds)"`
+	BatteryPollingInterval int    `description:"Battery polling interval (in seconds)"`
+	DeviceID               int    `description:"HCI device index (-1 for the first available device)"`
+	SamplingMode           string `description:"Sampling mode ('continuous', 'interval' or 'adaptive')"`
+	SamplingInterval       int    `description:"Time between samples in interval and adaptive modes (in seconds)"`
+}
+
+func (c *IbbqConfiguration) asConfig() (ibbq.Configuration, error) {
+	config, err := ibbq.NewConfiguration(
+		time.Duration(c.ConnectTimeout)*time.Second,
+		time.Duration(c.BatteryPollingInterval)*time.Second,
+	)
+	if err != nil {
+		return config, err
+	}
+	config.Address = c.Address
+	config.DeviceID = c.DeviceID
+	config.SamplingMode = ibbq.SamplingMode(c.SamplingMode)
+	config.SamplingInterval = time.Duration(c.SamplingInterval) * time.Second
+	return config, nil
+}
+
+// MQTTConfiguration is our MQTT broker configuration
+type MQTTConfiguration struct {
+	Broker               string `description:"MQTT broker URL (e.g. 'tcp://localhost:1883' or 'ssl://broker:8883')"`
+	ClientID             string `description:"MQTT client ID"`
+	Topic                string `description:"Topic under which everything is published"`
+	Username             string `description:"MQTT username (none if empty)"`
+	Password             string `description:"MQTT password"`
+	QoS                  int    `description:"QoS for published messages (0, 1 or 2)"`
+	Retain               bool   `description:"Retain readings, as well as the status and availability which are always retained"`
+	CACert               string `description:"PEM file of CA certificates to verify the broker with (the system's if empty)"`
+	ClientCert           string `description:"PEM certificate file for client authentication (none if empty)"`
+	ClientKey            string `description:"PEM key file for the client certificate"`
+	InsecureSkipVerify   bool   `description:"Don't verify the broker's certificate"`
+	KeepAlive            int    `description:"MQTT keep alive interval (in seconds)"`
+	MaxReconnectInterval int    `description:"Longest time between attempts to reconnect to the broker (in seconds)"`
+	BufferSize           int    `description:"Number of messages kept while the broker is unreachable (the oldest are dropped beyond it)"`
+}
+
+func (c *MQTTConfiguration) validate() error {
+	if c.QoS < 0 || c.QoS > 2 {
+		return fmt.Errorf("invalid QoS %d", c.QoS)
+	}
+	if c.Broker == "" {
+		return errors.New("no broker given")
+	}
+	if c.KeepAlive <= 0 {
+		return errors.New("keep alive interval must be positive")
+	}
+	if c.MaxReconnectInterval <= 0 {
+		return errors.New("maximum reconnect interval must be positive")
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS configuration, or nil if none of the TLS settings were given, leaving the defaults
+// for ssl:// brokers.
+func (c *MQTTConfiguration) tlsConfig() (*tls.Config, error) {
+	if c.CACert == "" && c.ClientCert == "" && !c.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CACert != "" {
+		pem, err := ioutil.ReadFile(c.CACert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CACert)
+		}
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
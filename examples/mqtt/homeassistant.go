@@ -0,0 +1,216 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+// publisher publishes a payload to a topic.
+type publisher func(topic string, retained bool, payload string)
+
+// homeAssistant publishes Home Assistant MQTT discovery config, and the per-probe state topics it refers to, so
+// that the thermometer shows up in Home Assistant without any configuration. See
+// https://www.home-assistant.io/docs/mqtt/discovery/.
+//
+// Each probe is a temperature sensor, with its own state topic and availability topic, which is offline while the
+// probe is unplugged or the thermometer is disconnected. The bridge's availability topic is set as its last will,
+// so every entity becomes unavailable if the bridge goes away.
+//
+// Home Assistant, and brokers which don't persist retained messages, forget the config when they restart, so it is
+// announced again whenever the broker is connected to, and whenever Home Assistant comes online.
+type homeAssistant struct {
+	prefix  string
+	topic   string
+	names   []string
+	address func() string
+	publish publisher
+
+	mu        sync.Mutex
+	node      string
+	device    map[string]interface{}
+	announced int
+	plugged   []bool
+	connected string
+}
+
+func newHomeAssistant(prefix, topic string, names []string, address func() string, publish publisher) *homeAssistant {
+	return &homeAssistant{prefix: prefix, topic: topic, names: names, address: address, publish: publish}
+}
+
+// statusTopic is the topic on which Home Assistant publishes "online" when it starts.
+func (h *homeAssistant) statusTopic() string {
+	return h.prefix + "/status"
+}
+
+// statusReceived announces everything again when Home Assistant comes online.
+func (h *homeAssistant) statusReceived(payload string) {
+	if payload == "online" {
+		h.reannounce()
+	}
+}
+
+// reannounce publishes the config of everything announced so far, along with each probe's availability and the
+// thermometer's connectivity.
+func (h *homeAssistant) reannounce() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.node == "" {
+		return
+	}
+	h.announceDevice()
+	for probe := 0; probe < h.announced; probe++ {
+		h.announceProbe(probe)
+		h.publish(h.probeTopic(probe)+"/availability", true, availability(h.plugged[probe]))
+	}
+	if h.connected != "" {
+		h.publish(h.topic+"/connected", true, h.connected)
+	}
+}
+
+func (h *homeAssistant) availabilityTopic() string {
+	return h.topic + "/availability"
+}
+
+func (h *homeAssistant) probeTopic(probe int) string {
+	return h.topic + "/probe/" + strconv.Itoa(probe+1)
+}
+
+// readingReceived publishes each probe's temperature, marking unplugged probes unavailable, and announces any
+// probes which haven't been yet.
+func (h *homeAssistant) readingReceived(reading ibbq.Reading) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.node == "" {
+		address := h.address()
+		if address == "" {
+			return
+		}
+		h.node = "ibbq_" + strings.Replace(strings.ToLower(address), ":", "", -1)
+		h.device = map[string]interface{}{
+			"identifiers":  []string{h.node},
+			"connections":  [][]string{{"mac", strings.ToLower(address)}},
+			"name":         "iBBQ " + address,
+			"manufacturer": "Inkbird",
+			"model":        "iBBQ",
+		}
+		h.announceDevice()
+	}
+	for len(h.plugged) < len(reading.Temperatures) {
+		h.plugged = append(h.plugged, false)
+	}
+	for probe, temperature := range reading.Temperatures {
+		if probe >= h.announced {
+			h.announceProbe(probe)
+			h.announced = probe + 1
+			// publish its availability below, whatever it was before
+			h.plugged[probe] = !ibbq.ProbeConnected(temperature)
+		}
+		plugged := ibbq.ProbeConnected(temperature)
+		if plugged != h.plugged[probe] {
+			h.plugged[probe] = plugged
+			h.publish(h.probeTopic(probe)+"/availability", true, availability(plugged))
+		}
+		if plugged {
+			h.publish(h.probeTopic(probe), false, strconv.FormatFloat(temperature, 'f', -1, 64))
+		}
+	}
+}
+
+// statusUpdated publishes the thermometer's connectivity, marking every probe unavailable while it is disconnected.
+func (h *homeAssistant) statusUpdated(status ibbq.Status) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch status {
+	case ibbq.Connected:
+		h.connected = "ON"
+		h.publish(h.topic+"/connected", true, h.connected)
+	case ibbq.Disconnected:
+		h.connected = "OFF"
+		h.publish(h.topic+"/connected", true, h.connected)
+		for probe := range h.plugged {
+			if h.plugged[probe] {
+				h.plugged[probe] = false
+				h.publish(h.probeTopic(probe)+"/availability", true, availability(false))
+			}
+		}
+	}
+}
+
+func availability(available bool) string {
+	if available {
+		return "online"
+	}
+	return "offline"
+}
+
+// announceDevice publishes the config for the battery and connectivity entities. Every entity refers to the
+// device, so that Home Assistant groups them together.
+func (h *homeAssistant) announceDevice() {
+	h.announce("sensor", "battery", map[string]interface{}{
+		"name":                "iBBQ Battery",
+		"unique_id":           h.node + "_battery",
+		"device_class":        "battery",
+		"unit_of_measurement": "%",
+		"state_topic":         h.topic + "/battery",
+		"availability_topic":  h.availabilityTopic(),
+		"device":              h.device,
+	})
+	h.announce("binary_sensor", "connectivity", map[string]interface{}{
+		"name":               "iBBQ Connected",
+		"unique_id":          h.node + "_connectivity",
+		"device_class":       "connectivity",
+		"state_topic":        h.topic + "/connected",
+		"availability_topic": h.availabilityTopic(),
+		"device":             h.device,
+	})
+}
+
+// announceProbe publishes the config for a probe's temperature sensor. It is only available while both the bridge
+// and the probe are.
+func (h *homeAssistant) announceProbe(probe int) {
+	name := "Probe " + strconv.Itoa(probe+1)
+	if probe < len(h.names) && h.names[probe] != "" {
+		name = h.names[probe]
+	}
+	h.announce("sensor", "probe"+strconv.Itoa(probe+1), map[string]interface{}{
+		"name":                "iBBQ " + name,
+		"unique_id":           h.node + "_probe" + strconv.Itoa(probe+1),
+		"device_class":        "temperature",
+		"unit_of_measurement": "°C",
+		"state_topic":         h.probeTopic(probe),
+		"availability": []map[string]string{
+			{"topic": h.availabilityTopic()},
+			{"topic": h.probeTopic(probe) + "/availability"},
+		},
+		"availability_mode": "all",
+		"device":            h.device,
+	})
+}
+
+func (h *homeAssistant) announce(component, object string, config map[string]interface{}) {
+	payload, err := json.Marshal(config)
+	if err != nil {
+		logger.Error("Can't encode discovery config to JSON", "err", err)
+		return
+	}
+	h.publish(h.prefix+"/"+component+"/"+h.node+"/"+object+"/config", true, string(payload))
+}
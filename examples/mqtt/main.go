@@ -17,101 +17,145 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
-	"github.com/go-ble/ble"
+	"github.com/containous/flaeg"
+	"github.com/containous/staert"
 	log "github.com/mgutz/logxi/v1"
 	"github.com/sworisbreathing/go-ibbq/v2"
-
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sworisbreathing/go-ibbq/v2/estimate"
+	"github.com/sworisbreathing/go-ibbq/v2/rate"
 )
 
 var logger = log.New("main")
-var mqClient mqtt.Client
 
-const topic = "home/iBBQ"
-const broker = "tcp://192.168.1.196:1883"
-const clientID = "go_ibbq"
+func main() {
+	command := newCommand(run)
+	s := staert.NewStaert(command)
+	toml := staert.NewTomlSource("ibbq-mqtt", []string{"."})
+	f := flaeg.New(command, os.Args[1:])
+	if _, err := f.Parse(command); err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	s.AddSource(toml)
+	s.AddSource(f)
+	if _, err := s.LoadConfig(); err != nil {
+		logger.Fatal(err.Error())
+	}
+	if err := s.Run(); err != nil {
+		logger.Fatal(err.Error())
+	}
+	logger.Info("Exiting")
+}
 
-var mqttPublishHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-	logger.Info("TOPIC: ", msg.Topic())
-	logger.Info("MSG: ", msg.Payload())
+func temperatureReceived(b *bridge, topic string) ibbq.TemperatureReceivedHandler {
+	return func(temperatures []float64) {
+		b.publishJSON(topic+"/temperature", temperatures)
+	}
 }
 
-func temperatureReceived(temperatures []float64) {
-	m, err := json.Marshal(temperatures)
-	if err != nil {
-		logger.Fatal("Can't encode to JSON", "err", err)
+func batteryLevelReceived(b *bridge, topic string) ibbq.BatteryLevelReceivedHandler {
+	return func(batteryLevel int) {
+		b.publishJSON(topic+"/battery", batteryLevel)
 	}
-	token := mqClient.Publish(topic+"/temperature", 0, false, m)
-	token.Wait()
 }
-func batteryLevelReceived(batteryLevel int) {
-	m, err := json.Marshal(batteryLevel)
-	if err != nil {
-		logger.Fatal("Can't encode to JSON", "err", err)
+
+func ratesUpdated(b *bridge, topic string, rates *rate.Calculator) ibbq.ReadingHandler {
+	return func(reading ibbq.Reading) {
+		currentRates := make([]interface{}, len(reading.Temperatures))
+		for probe := range currentRates {
+			if r, ok := rates.Rate(probe); ok {
+				currentRates[probe] = r
+			}
+		}
+		b.publishJSON(topic+"/rate", currentRates)
 	}
-	token := mqClient.Publish(topic+"/battery", 0, false, m)
-	token.Wait()
 }
-func statusUpdated(status ibbq.Status) {
-	logger.Info("Status updated", "status", status)
+
+func estimateReceived(b *bridge, topic string) estimate.Handler {
+	return func(e estimate.Estimate) {
+		b.publishJSON(topic+"/eta", map[string]interface{}{
+			"probe":    e.Probe + 1,
+			"target":   e.Target,
+			"reached":  e.Reached,
+			"eta":      e.ETA,
+			"earliest": e.Earliest,
+			"latest":   e.Latest,
+		})
+	}
 }
 
-func disconnectedHandler(cancel func(), done chan struct{}) func() {
-	return func() {
-		logger.Info("Disconnected")
-		cancel()
-		close(done)
+// statusUpdated publishes the thermometer's status, retained so that it reflects the latest status.
+func statusUpdated(b *bridge, topic string, ha *homeAssistant) ibbq.StatusUpdatedHandler {
+	return func(status ibbq.Status) {
+		logger.Info("Status updated", "status", status)
+		b.publish(topic+"/status", true, string(status))
+		if ha != nil {
+			ha.statusUpdated(status)
+		}
 	}
 }
 
-func main() {
-	var err error
-	ctx1, cancel := context.WithCancel(context.Background())
+func run(config *Configuration) error {
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	registerInterruptHandler(cancel)
 
-	logger.Info("instantiating mqtt config")
-	opts := mqtt.NewClientOptions().AddBroker(broker).SetClientID(clientID)
-	opts.SetKeepAlive(2 * time.Second)
-	opts.SetDefaultPublishHandler(mqttPublishHandler)
-	opts.SetPingTimeout(1 * time.Second)
-
-	logger.Info("instatiating mqtt client")
-	mqClient = mqtt.NewClient(opts)
-
-	logger.Info("MQTT broker", "status", "connecting")
-	if token := mqClient.Connect(); token.Wait() && token.Error() != nil {
-		logger.Fatal("Error connecting to mqtt broker", "err", token.Error())
+	ibbqConfig, err := config.asConfig()
+	if err != nil {
+		return err
 	}
-	logger.Info("MQTT broker", "status", "connected")
-	token := mqClient.Publish(topic+"/status", 0, false, "Connected")
-	token.Wait()
-
-	logger.Debug("initializing context")
-
-	ctx := ble.WithSigHandler(ctx1, cancel)
-	logger.Debug("context initialized")
-	var bbq ibbq.Ibbq
-	logger.Debug("instantiating ibbq struct")
-	done := make(chan struct{})
-	var config ibbq.Configuration
-	if config, err = ibbq.NewConfiguration(60*time.Second, 5*time.Minute); err != nil {
-		logger.Fatal("Error creating configuration", "err", err)
+	targets, err := estimate.ParseTargets(config.Targets)
+	if err != nil {
+		return err
 	}
-	if bbq, err = ibbq.NewIbbq(ctx, config, disconnectedHandler(cancel, done), temperatureReceived, batteryLevelReceived, statusUpdated); err != nil {
-		logger.Fatal("Error creating iBBQ", "err", err)
+	b, err := newBridge(config.MQTTConfiguration)
+	if err != nil {
+		return err
 	}
-	logger.Debug("instantiated ibbq struct")
-	logger.Info("Connecting to device")
-	if err = bbq.Connect(); err != nil {
-		logger.Fatal("Error connecting to device", "err", err)
+	topic := config.Topic
+
+	var reconnector *ibbq.Reconnector
+	var ha *homeAssistant
+	if config.DiscoveryPrefix != "" {
+		var names []string
+		if config.Probes != "" {
+			names = strings.Split(config.Probes, ",")
+		}
+		ha = newHomeAssistant(config.DiscoveryPrefix, topic, names, func() string {
+			if bbq := reconnector.Current(); bbq != nil {
+				return bbq.Address()
+			}
+			return ""
+		}, b.publish)
+		b.addOnConnect(ha.reannounce)
+		b.addSubscription(ha.statusTopic(), ha.statusReceived)
 	}
-	logger.Info("Connected to device")
-	<-ctx.Done()
-	<-done
-	mqClient.Disconnect(250)
-	logger.Info("Exiting")
+	b.start()
+	defer b.close()
+
+	estimatorConfig := estimate.DefaultConfiguration
+	estimatorConfig.AmbientProbe = config.AmbientProbe - 1
+	estimatorConfig.Targets = targets
+	estimator := estimate.NewEstimator(estimatorConfig, estimateReceived(b, topic))
+	rates := rate.NewCalculator(rate.DefaultConfiguration, nil)
+	readingHandlers := []ibbq.ReadingHandler{estimator.Update, rates.Update, ratesUpdated(b, topic, rates)}
+	if ha != nil {
+		readingHandlers = append(readingHandlers, ha.readingReceived)
+	}
+	reconnector = ibbq.NewReconnector(func(ctx context.Context) (*ibbq.Ibbq, error) {
+		bbq, err := ibbq.NewIbbq(ctx, ibbqConfig, nil, temperatureReceived(b, topic), batteryLevelReceived(b, topic), statusUpdated(b, topic, ha))
+		if err != nil {
+			return nil, err
+		}
+		bbq.SetReadingHandler(ibbq.ReadingHandlers(readingHandlers...))
+		return &bbq, nil
+	})
+	reconnector.MaxDelay = time.Minute
+	reconnector.Run(ctx)
+	return nil
 }
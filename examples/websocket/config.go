@@ -19,12 +19,17 @@ import (
 	"time"
 
 	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/storage"
 )
 
 // Configuration is our app configuration
 type Configuration struct {
 	IbbqConfiguration
-	Port int `short:"p" description:"Web server port number"`
+	Port          int    `short:"p" description:"Web server port number"`
+	Targets       string `description:"Target temperatures in celsius, by probe number (e.g. '1=93,2=74')"`
+	AmbientProbe  int    `description:"Number of the probe measuring the cooker's temperature (0 if there isn't one)"`
+	Database      string `description:"Path to a database file keeping the history of readings (empty to keep no history)"`
+	RetentionDays int    `description:"Number of days of history to keep (0 to keep it forever)"`
 }
 
 // DefaultConfiguration is a somewhat sane set of default values.
@@ -33,20 +38,39 @@ var DefaultConfiguration = &Configuration{
 		ConnectTimeout:         int(ibbq.DefaultConfiguration.ConnectTimeout / time.Second),
 		BatteryPollingInterval: int(ibbq.DefaultConfiguration.BatteryPollingInterval / time.Second),
 		TemperatureUnits:       "f",
+		DeviceID:               ibbq.DefaultConfiguration.DeviceID,
+		SamplingMode:           string(ibbq.DefaultConfiguration.SamplingMode),
+		SamplingInterval:       int(ibbq.DefaultConfiguration.SamplingInterval / time.Second),
+		DeadbandMaxInterval:    60,
 	},
-	Port: 8080,
+	Port:          8080,
+	RetentionDays: int(storage.DefaultConfiguration.Retention / (24 * time.Hour)),
 }
 
 // IbbqConfiguration is our ibbq configuration
 type IbbqConfiguration struct {
-	ConnectTimeout         int    `description:"Connect timeout (in seconds)"`
-	BatteryPollingInterval int    `description:"Battery polling interval (in seconds)"`
-	TemperatureUnits       string `description:"Temperature units ('c'/'celsius' or 'f'/'fahrenheit', case-insensitive)"`
+	ConnectTimeout         int     `description:"Connect timeout (in seconds)"`
+	BatteryPollingInterval int     `description:"Battery polling interval (in seconds)"`
+	TemperatureUnits       string  `description:"Temperature units ('c'/'celsius' or 'f'/'fahrenheit', case-insensitive)"`
+	DeviceID               int     `description:"HCI device index (-1 for the first available device)"`
+	SamplingMode           string  `description:"Sampling mode ('continuous', 'interval' or 'adaptive')"`
+	SamplingInterval       int     `description:"Time between samples in interval and adaptive modes (in seconds)"`
+	Deadband               float64 `description:"Change in temperature (celsius) required before clients are updated (0 updates on every reading)"`
+	DeadbandMaxInterval    int     `description:"Maximum time between client updates while the deadband is in use (in seconds)"`
 }
 
 func (c *IbbqConfiguration) asConfig() (ibbq.Configuration, error) {
-	return ibbq.NewConfiguration(
+	config, err := ibbq.NewConfiguration(
 		time.Duration(c.ConnectTimeout)*time.Second,
 		time.Duration(c.BatteryPollingInterval)*time.Second,
 	)
+	if err != nil {
+		return config, err
+	}
+	config.DeviceID = c.DeviceID
+	config.SamplingMode = ibbq.SamplingMode(c.SamplingMode)
+	config.SamplingInterval = time.Duration(c.SamplingInterval) * time.Second
+	config.Deadband.Delta = c.Deadband
+	config.Deadband.MaxInterval = time.Duration(c.DeadbandMaxInterval) * time.Second
+	return config, nil
 }
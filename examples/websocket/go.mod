@@ -13,7 +13,7 @@ require (
 	github.com/mgutz/logxi v0.0.0-20161027140823-aebf8a7d67ab
 	github.com/ogier/pflag v0.0.1 // indirect
 	github.com/sworisbreathing/go-ibbq/v2 v2.0.0
-	golang.org/x/sync v0.0.0-20190423024810-112230192c58
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 )
 
 replace github.com/sworisbreathing/go-ibbq/v2 v2.0.0 => ../../
@@ -0,0 +1,158 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/storage"
+)
+
+// store keeps the history of readings, if a database has been configured.
+var store storage.Store
+
+// record stores data from the current ibbq, once we know its address.
+func record(add func(device string) error) {
+	if store == nil {
+		return
+	}
+	current.RLock()
+	bbq := current.bbq
+	current.RUnlock()
+	if bbq == nil || bbq.Address() == "" {
+		return
+	}
+	if err := add(bbq.Address()); err != nil {
+		logger.Error("Error storing history", "err", err)
+	}
+}
+
+func recordReading(reading ibbq.Reading) {
+	record(func(device string) error { return store.AddReading(device, reading) })
+}
+
+func recordBattery(battery ibbq.Battery) {
+	record(func(device string) error { return store.AddBattery(device, battery) })
+}
+
+func recordStatus(status ibbq.Status) {
+	record(func(device string) error { return store.AddStatus(device, time.Now(), status) })
+}
+
+// compactHistory applies the store's retention policy every hour, until the context is done.
+func compactHistory(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			if err := store.Compact(t); err != nil {
+				logger.Error("Error compacting history", "err", err)
+			}
+		}
+	}
+}
+
+// historyQuery parses the device, probes (numbered from 1), from, to (RFC 3339) and limit query parameters.
+func historyQuery(c *gin.Context) (storage.Query, error) {
+	query := storage.Query{Device: c.Query("device")}
+	var err error
+	if probes := c.Query("probes"); probes != "" {
+		for _, p := range strings.Split(probes, ",") {
+			var probe int
+			if probe, err = strconv.Atoi(strings.TrimSpace(p)); err != nil {
+				return query, err
+			}
+			query.Probes = append(query.Probes, probe-1)
+		}
+	}
+	if from := c.Query("from"); from != "" {
+		if query.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return query, err
+		}
+	} else {
+		query.From = time.Now().Add(-24 * time.Hour)
+	}
+	if to := c.Query("to"); to != "" {
+		if query.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return query, err
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+func addHistoryRoutes(router *gin.Engine) {
+	router.GET("/history/temperatures", func(c *gin.Context) {
+		query, err := historyQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		samples, err := store.Readings(query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"samples": samples})
+	})
+	router.GET("/history/battery", func(c *gin.Context) {
+		query, err := historyQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		batteries, err := store.Batteries(query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"battery": batteries})
+	})
+	router.GET("/history/status", func(c *gin.Context) {
+		query, err := historyQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		statuses, err := store.Statuses(query)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": statuses})
+	})
+	router.GET("/history/devices", func(c *gin.Context) {
+		devices, err := store.Devices()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"devices": devices})
+	})
+}
@@ -35,6 +35,9 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/mgutz/logxi/v1"
 	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/estimate"
+	"github.com/sworisbreathing/go-ibbq/v2/rate"
+	"github.com/sworisbreathing/go-ibbq/v2/storage"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -45,6 +48,8 @@ var tempsChannel = make(chan []float64)
 var batteryLevelChannel = make(chan []int)
 var statusChannel = make(chan *ibbq.Status)
 var shutdown = false
+var estimator *estimate.Estimator
+var rates = rate.NewCalculator(rate.DefaultConfiguration, nil)
 
 func main() {
 	command := newCommand(run)
@@ -72,20 +77,39 @@ func run(config *Configuration) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	registerInterruptHandler(cancel)
+	estimatorConfig := estimate.DefaultConfiguration
+	estimatorConfig.AmbientProbe = config.AmbientProbe - 1
+	var err error
+	if estimatorConfig.Targets, err = estimate.ParseTargets(config.Targets); err != nil {
+		return err
+	}
+	estimator = estimate.NewEstimator(estimatorConfig, nil)
 	router := gin.Default()
+	if config.Database != "" {
+		storageConfig := storage.DefaultConfiguration
+		storageConfig.Retention = time.Duration(config.RetentionDays) * 24 * time.Hour
+		boltStore, err := storage.OpenBolt(config.Database, storageConfig)
+		if err != nil {
+			return err
+		}
+		defer boltStore.Close()
+		store = boltStore
+		go compactHistory(ctx)
+		addHistoryRoutes(router)
+	}
 	var g errgroup.Group
-	temps := []float64{}
-	batteryLevel := 0
-	status := ibbq.Disconnected
 	router.GET("/temperatureData", func(c *gin.Context) {
+		_, _, temps := currentData()
 		c.JSON(
 			http.StatusOK,
 			gin.H{
 				"temperatures": temps,
+				"rates":        currentRates(len(temps)),
 			},
 		)
 	})
 	router.GET("/batteryLevel", func(c *gin.Context) {
+		_, batteryLevel, _ := currentData()
 		c.JSON(
 			http.StatusOK,
 			gin.H{
@@ -94,12 +118,15 @@ func run(config *Configuration) error {
 		)
 	})
 	router.GET("/allData", func(c *gin.Context) {
+		status, batteryLevel, temps := currentData()
 		c.JSON(
 			http.StatusOK,
 			gin.H{
 				"status":       status,
 				"batteryLevel": batteryLevel,
 				"temperatures": temps,
+				"rates":        currentRates(len(temps)),
+				"estimates":    currentEstimates(),
 			},
 		)
 	})
@@ -121,25 +148,19 @@ func run(config *Configuration) error {
 					logger.Info("temps channel closed")
 					return nil
 				}
-				temps = t
-				go updateWebsockets(status, batteryLevel, temps)
+				go updateWebsockets(currentData())
 			case bl := <-batteryLevelChannel:
 				if bl == nil {
 					logger.Info("battery level channel closed")
 					return nil
 				}
-				batteryLevel = bl[0]
-				go updateWebsockets(status, batteryLevel, temps)
+				go updateWebsockets(currentData())
 			case s := <-statusChannel:
 				if s == nil {
 					logger.Info("status channel closed")
 					return nil
-				} else if *s != ibbq.Connected {
-					batteryLevel = 0
-					temps = []float64{}
 				}
-				status = *s
-				go updateWebsockets(status, batteryLevel, temps)
+				go updateWebsockets(currentData())
 			case <-done:
 				logger.Info("shutdown detected")
 				close(tempsChannel)
@@ -156,11 +177,12 @@ func run(config *Configuration) error {
 				return nil
 			}
 			logger.Info("Connecting to ibbq")
-			if bbq, err := startIbbq(ctx, cancel, config.IbbqConfiguration, tempsChannel, batteryLevelChannel, statusChannel); err != nil {
+			bbq, err := startIbbq(ctx, cancel, config.IbbqConfiguration, tempsChannel, batteryLevelChannel, statusChannel)
+			if bbq != nil {
+				bbq.Close()
+			}
+			if err != nil {
 				logger.Error("error connecting", "err", err)
-				if bbq != nil {
-					bbq.Disconnect(true)
-				}
 				time.Sleep(30 * time.Second)
 			}
 		}
@@ -206,11 +228,15 @@ func startIbbq(ctx1 context.Context, cancel1 func(), config IbbqConfiguration, t
 		batteryLevelChannel <- []int{batteryLevel}
 	}
 	statusUpdated := func(status ibbq.Status) {
+		recordStatus(status)
 		statusChannel <- &status
 	}
 	if bbq, err = ibbq.NewIbbq(ctx, ibbqConfig, disconnectedHandler, temperatureReceived, batteryLevelReceived, statusUpdated); err != nil {
 		return nil, err
 	}
+	bbq.SetReadingHandler(ibbq.ReadingHandlers(estimator.Update, rates.Update, recordReading))
+	bbq.SetBatteryHandler(recordBattery)
+	setCurrentIbbq(&bbq)
 	if err = bbq.Connect(); err != nil {
 		return &bbq, err
 	}
@@ -232,6 +258,70 @@ func startIbbq(ctx1 context.Context, cancel1 func(), config IbbqConfiguration, t
 	return &bbq, nil
 }
 
+var current = struct {
+	sync.RWMutex
+	bbq *ibbq.Ibbq
+}{}
+
+func setCurrentIbbq(bbq *ibbq.Ibbq) {
+	current.Lock()
+	current.bbq = bbq
+	current.Unlock()
+}
+
+// currentData returns the status, battery level and temperatures of the current ibbq.
+func currentData() (ibbq.Status, int, []float64) {
+	current.RLock()
+	bbq := current.bbq
+	current.RUnlock()
+	if bbq == nil {
+		return ibbq.Disconnected, 0, []float64{}
+	}
+	status := bbq.Status()
+	if status != ibbq.Connected {
+		return status, 0, []float64{}
+	}
+	batteryLevel := 0
+	if battery, ok := bbq.LastBattery(); ok {
+		batteryLevel = battery.Percent
+	}
+	temps := []float64{}
+	if reading, ok := bbq.LastReading(); ok {
+		temps = reading.Temperatures
+	}
+	return status, batteryLevel, temps
+}
+
+// currentRates returns the rate of change of each probe, in celsius per minute, or nil where it isn't known yet.
+func currentRates(probes int) []interface{} {
+	currentRates := make([]interface{}, probes)
+	for probe := range currentRates {
+		if r, ok := rates.Rate(probe); ok {
+			currentRates[probe] = r
+		}
+	}
+	return currentRates
+}
+
+// currentEstimates returns the estimated time to target of each probe with a target.
+func currentEstimates() []gin.H {
+	estimates := []gin.H{}
+	for _, e := range estimator.Estimates() {
+		estimate := gin.H{
+			"probe":   e.Probe,
+			"target":  e.Target,
+			"reached": e.Reached,
+			"eta":     e.ETA,
+		}
+		if !e.Latest.IsZero() {
+			estimate["earliest"] = e.Earliest
+			estimate["latest"] = e.Latest
+		}
+		estimates = append(estimates, estimate)
+	}
+	return estimates
+}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -277,6 +367,8 @@ func updateWebsockets(status ibbq.Status, batteryLevel int, temps []float64) {
 					"status":       status,
 					"batteryLevel": batteryLevel,
 					"temps":        temps,
+					"rates":        currentRates(len(temps)),
+					"estimates":    currentEstimates(),
 				},
 			); err != nil {
 				if isClosedError(err) {
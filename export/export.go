@@ -0,0 +1,298 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package export batches readings into time-series databases, such as InfluxDB and Prometheus,
+// buffering them while the database is unreachable.
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mgutz/logxi/v1"
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+var logger = log.New("export")
+
+// Point is one probe's temperature at a point in time.
+type Point struct {
+	// Device identifies the device, e.g. by its address.
+	Device string
+	// Probe is the probe's index.
+	Probe int
+	// Name is the probe's name, e.g. "pit".
+	Name string
+	// Session identifies the cook session, if any.
+	Session string
+	// Time is when the temperature was read.
+	Time time.Time
+	// Temperature is in celsius.
+	Temperature float64
+}
+
+// Backend writes points to a time-series database.
+type Backend interface {
+	Write(ctx context.Context, points []Point) error
+}
+
+// Configuration configures an Exporter.
+type Configuration struct {
+	// ProbeNames names each probe, by probe index. Probes without a name are called probe1, probe2, etc.
+	ProbeNames []string
+	// BatchSize is how many points are written at once. Zero uses the default.
+	BatchSize int
+	// FlushInterval is the longest points wait before being written. Zero uses the default.
+	FlushInterval time.Duration
+	// MaxBuffered is how many points are kept while the backend is unreachable. The oldest are dropped beyond it.
+	// Zero uses the default.
+	MaxBuffered int
+	// Timeout limits each write, and the final flush when the exporter is closed. Zero uses the default.
+	Timeout time.Duration
+}
+
+// DefaultConfiguration is a somewhat sane default.
+var DefaultConfiguration = Configuration{
+	BatchSize:     500,
+	FlushInterval: 10 * time.Second,
+	MaxBuffered:   100000,
+	Timeout:       10 * time.Second,
+}
+
+// Exporter batches readings and writes them to a backend, until it is closed.
+type Exporter struct {
+	mu        sync.Mutex
+	config    Configuration
+	backend   Backend
+	session   string
+	buffer    []Point
+	dropped   int
+	discarded int
+	flush     chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewExporter creates an exporter, which writes to the backend in the background.
+// Unset batch sizes, intervals, buffer limits and timeouts are taken from DefaultConfiguration.
+func NewExporter(config Configuration, backend Backend) *Exporter {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultConfiguration.BatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultConfiguration.FlushInterval
+	}
+	if config.MaxBuffered <= 0 {
+		config.MaxBuffered = DefaultConfiguration.MaxBuffered
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfiguration.Timeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &Exporter{
+		config:  config,
+		backend: backend,
+		flush:   make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// SetSession sets the cook session which subsequent points are tagged with. An empty ID leaves them untagged.
+func (e *Exporter) SetSession(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.session = id
+}
+
+// Handler returns a reading handler which exports readings from the given device.
+func (e *Exporter) Handler(device string) ibbq.ReadingHandler {
+	return func(reading ibbq.Reading) {
+		e.Add(device, reading)
+	}
+}
+
+// Add queues a reading from a device for export. Unplugged probes are left out.
+func (e *Exporter) Add(device string, reading ibbq.Reading) {
+	e.mu.Lock()
+	for probe, temperature := range reading.Temperatures {
+		if !ibbq.ProbeConnected(temperature) {
+			continue
+		}
+		e.buffer = append(e.buffer, Point{
+			Device:      device,
+			Probe:       probe,
+			Name:        e.probeName(probe),
+			Session:     e.session,
+			Time:        reading.Time,
+			Temperature: temperature,
+		})
+	}
+	if excess := len(e.buffer) - e.config.MaxBuffered; excess > 0 {
+		e.buffer = append(e.buffer[:0], e.buffer[excess:]...)
+		e.dropped += excess
+		e.discarded += excess
+	}
+	full := len(e.buffer) >= e.config.BatchSize
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *Exporter) probeName(probe int) string {
+	if probe < len(e.config.ProbeNames) && e.config.ProbeNames[probe] != "" {
+		return e.config.ProbeNames[probe]
+	}
+	return "probe" + strconv.Itoa(probe+1)
+}
+
+// Buffered returns how many points are waiting to be written.
+func (e *Exporter) Buffered() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.buffer)
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.flush:
+		}
+		if err := e.Flush(e.ctx); err != nil {
+			logger.Warn("Error exporting points, will retry", "buffered", e.Buffered(), "err", err)
+		}
+	}
+}
+
+// Flush writes the buffered points in batches, stopping at the first error.
+// Points which could not be written are kept, to be retried.
+func (e *Exporter) Flush(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		if e.dropped > 0 {
+			logger.Warn("Export buffer full, dropped oldest points", "dropped", e.dropped)
+			e.dropped = 0
+		}
+		n := len(e.buffer)
+		if n > e.config.BatchSize {
+			n = e.config.BatchSize
+		}
+		batch := append([]Point(nil), e.buffer[:n]...)
+		discarded := e.discarded
+		e.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := e.write(ctx, batch); err != nil {
+			if !rejected(err) {
+				return err
+			}
+			// retrying won't help, so the batch is dropped rather than holding up the points after it
+			logger.Error("Export rejected, dropping points", "points", len(batch), "err", err)
+		}
+		e.mu.Lock()
+		// the buffer may have had its oldest points dropped while we were writing
+		written := len(batch) - (e.discarded - discarded)
+		if written < 0 {
+			written = 0
+		}
+		e.buffer = append(e.buffer[:0], e.buffer[written:]...)
+		e.mu.Unlock()
+	}
+}
+
+func (e *Exporter) write(ctx context.Context, batch []Point) error {
+	ctx, cancel := context.WithTimeout(ctx, e.config.Timeout)
+	defer cancel()
+	return e.backend.Write(ctx, batch)
+}
+
+// Close stops exporting, after trying once more to write any buffered points.
+func (e *Exporter) Close() error {
+	var err error
+	e.closeOnce.Do(func() {
+		e.cancel()
+		<-e.done
+		ctx, cancel := context.WithTimeout(context.Background(), e.config.Timeout)
+		defer cancel()
+		err = e.Flush(ctx)
+	})
+	return err
+}
+
+// HTTPError reports a write rejected by an HTTP server.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("server responded with %d: %s", e.StatusCode, e.Body)
+}
+
+// rejected reports whether an error is the server refusing the points themselves, rather than being unavailable.
+func rejected(err error) bool {
+	httpErr, ok := err.(*HTTPError)
+	return ok && httpErr.StatusCode >= 400 && httpErr.StatusCode < 500 &&
+		httpErr.StatusCode != http.StatusTooManyRequests && httpErr.StatusCode != http.StatusRequestTimeout
+}
+
+func post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		text, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(text))}
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
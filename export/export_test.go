@@ -0,0 +1,190 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package export
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+// fakeBackend records the batches written to it, failing with err while it is set.
+type fakeBackend struct {
+	mu      sync.Mutex
+	err     error
+	batches [][]Point
+}
+
+func (b *fakeBackend) Write(ctx context.Context, points []Point) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if b.err != nil {
+		return b.err
+	}
+	b.batches = append(b.batches, points)
+	return nil
+}
+
+func (b *fakeBackend) setErr(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+func (b *fakeBackend) written() []Point {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var points []Point
+	for _, batch := range b.batches {
+		points = append(points, batch...)
+	}
+	return points
+}
+
+func reading(temperatures ...float64) ibbq.Reading {
+	return ibbq.Reading{Time: time.Unix(1600000000, 0), Temperatures: temperatures}
+}
+
+func TestNewExporterDefaults(t *testing.T) {
+	backend := &fakeBackend{}
+	e := NewExporter(Configuration{}, backend)
+	if e.config.BatchSize != DefaultConfiguration.BatchSize {
+		t.Errorf("got batch size %d, want %d", e.config.BatchSize, DefaultConfiguration.BatchSize)
+	}
+	if e.config.FlushInterval != DefaultConfiguration.FlushInterval {
+		t.Errorf("got flush interval %v, want %v", e.config.FlushInterval, DefaultConfiguration.FlushInterval)
+	}
+	if e.config.MaxBuffered != DefaultConfiguration.MaxBuffered {
+		t.Errorf("got max buffered %d, want %d", e.config.MaxBuffered, DefaultConfiguration.MaxBuffered)
+	}
+	if e.config.Timeout != DefaultConfiguration.Timeout {
+		t.Errorf("got timeout %v, want %v", e.config.Timeout, DefaultConfiguration.Timeout)
+	}
+	e.Add("dev", reading(21.5, ibbq.UnpluggedTemperature, 60))
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	points := backend.written()
+	if len(points) != 2 {
+		t.Fatalf("got %d points written on close, want 2", len(points))
+	}
+	want := Point{Device: "dev", Probe: 2, Name: "probe3", Time: time.Unix(1600000000, 0), Temperature: 60}
+	if points[1] != want {
+		t.Errorf("got %+v, want %+v", points[1], want)
+	}
+}
+
+func TestExporter(t *testing.T) {
+	unavailable := &HTTPError{StatusCode: http.StatusServiceUnavailable}
+	tests := []struct {
+		name        string
+		config      Configuration
+		err         error
+		readings    int
+		wantWritten int
+		wantKept    int
+	}{
+		{"batches", Configuration{BatchSize: 4}, nil, 5, 10, 0},
+		{"network error is retried", Configuration{}, errors.New("connection refused"), 3, 0, 6},
+		{"unavailable is retried", Configuration{}, unavailable, 3, 0, 6},
+		{"too many requests is retried", Configuration{}, &HTTPError{StatusCode: http.StatusTooManyRequests}, 3, 0, 6},
+		{"rejected points are dropped", Configuration{}, &HTTPError{StatusCode: http.StatusBadRequest}, 3, 0, 0},
+		{"oldest are dropped when full", Configuration{MaxBuffered: 4}, unavailable, 3, 0, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := &fakeBackend{err: test.err}
+			e := NewExporter(test.config, backend)
+			defer e.Close()
+			for i := 0; i < test.readings; i++ {
+				e.Add("dev", reading(float64(i), float64(i)+0.5))
+			}
+			err := e.Flush(context.Background())
+			if (err != nil) != (test.wantKept > 0) {
+				t.Errorf("got error %v", err)
+			}
+			if written := len(backend.written()); written != test.wantWritten {
+				t.Errorf("got %d points written, want %d", written, test.wantWritten)
+			}
+			if kept := e.Buffered(); kept != test.wantKept {
+				t.Errorf("got %d points kept, want %d", kept, test.wantKept)
+			}
+			backend.mu.Lock()
+			for _, batch := range backend.batches {
+				if len(batch) > e.config.BatchSize {
+					t.Errorf("got a batch of %d points, want at most %d", len(batch), e.config.BatchSize)
+				}
+			}
+			backend.mu.Unlock()
+			if test.wantKept == 0 {
+				return
+			}
+			// once the backend recovers, the kept points are written, oldest first
+			backend.setErr(nil)
+			if err := e.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			points := backend.written()
+			if len(points) != test.wantKept {
+				t.Fatalf("got %d points written after recovering, want %d", len(points), test.wantKept)
+			}
+			if want := float64(test.readings - test.wantKept/2); points[0].Temperature != want {
+				t.Errorf("got %v as the oldest point kept, want %v", points[0].Temperature, want)
+			}
+		})
+	}
+}
+
+func TestExporterFlushesInBackground(t *testing.T) {
+	backend := &fakeBackend{}
+	e := NewExporter(Configuration{FlushInterval: 5 * time.Millisecond}, backend)
+	defer e.Close()
+	e.Add("dev", reading(20))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(backend.written()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("points weren't flushed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExporterSession(t *testing.T) {
+	backend := &fakeBackend{}
+	e := NewExporter(Configuration{ProbeNames: []string{"pit", ""}}, backend)
+	e.SetSession("brisket")
+	e.Handler("dev")(reading(110, 70))
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	points := backend.written()
+	if len(points) != 2 {
+		t.Fatalf("got %d points, want 2", len(points))
+	}
+	for i, name := range []string{"pit", "probe2"} {
+		if points[i].Name != name || points[i].Session != "brisket" {
+			t.Errorf("got %+v, want name %q and session %q", points[i], name, "brisket")
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// InfluxDB writes points to InfluxDB's HTTP API in line protocol, as the measurement's "celsius" field,
+// tagged with the device, probe number (from 1), probe name and session.
+type InfluxDB struct {
+	// URL is the write endpoint, including its query parameters,
+	// e.g. http://localhost:8086/write?db=bbq or http://localhost:8086/api/v2/write?org=home&bucket=bbq.
+	URL string
+	// Measurement is the measurement's name.
+	Measurement string
+	// Token, if set, is sent as an InfluxDB 2 API token.
+	Token string
+	// Username and Password, if set, are sent with basic authentication.
+	Username string
+	Password string
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewInfluxDB creates a backend writing to the given write endpoint, as the "temperature" measurement.
+func NewInfluxDB(url string) *InfluxDB {
+	return &InfluxDB{URL: url, Measurement: "temperature"}
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// Write writes the points.
+func (i *InfluxDB) Write(ctx context.Context, points []Point) error {
+	var body bytes.Buffer
+	for _, p := range points {
+		body.WriteString(measurementEscaper.Replace(i.Measurement))
+		writeTag(&body, "device", p.Device)
+		writeTag(&body, "probe", strconv.Itoa(p.Probe+1))
+		writeTag(&body, "name", p.Name)
+		writeTag(&body, "session", p.Session)
+		body.WriteString(" celsius=")
+		body.WriteString(strconv.FormatFloat(p.Temperature, 'f', -1, 64))
+		body.WriteByte(' ')
+		body.WriteString(strconv.FormatInt(p.Time.UnixNano(), 10))
+		body.WriteByte('\n')
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.Token != "" {
+		header.Set("Authorization", "Token "+i.Token)
+	}
+	if i.Username != "" {
+		header.Set("Authorization", basicAuth(i.Username, i.Password))
+	}
+	return post(ctx, i.Client, i.URL, header, body.Bytes())
+}
+
+// writeTag writes a tag, leaving out empty ones, which line protocol doesn't allow.
+func writeTag(w *bytes.Buffer, key, value string) {
+	if value == "" {
+		return
+	}
+	w.WriteByte(',')
+	w.WriteString(key)
+	w.WriteByte('=')
+	w.WriteString(tagEscaper.Replace(value))
+}
+
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
@@ -0,0 +1,185 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request is what a test server received.
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// newServer starts a server which records requests and responds with the status.
+func newServer(t *testing.T, status int) (*httptest.Server, <-chan request) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		requests <- request{header: r.Header, body: body}
+		w.WriteHeader(status)
+		w.Write([]byte("  go away \n"))
+	}))
+	return server, requests
+}
+
+// linePoint is a point decoded from line protocol.
+type linePoint struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]string
+	timestamp   string
+}
+
+// splitUnescaped splits s at each unescaped sep, leaving escapes in place.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=").Replace(s)
+}
+
+// parseLineProtocol decodes the points written in line protocol.
+func parseLineProtocol(t *testing.T, body string) []linePoint {
+	var points []linePoint
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		parts := splitUnescaped(line, ' ')
+		if len(parts) != 3 {
+			t.Fatalf("line %q doesn't have a measurement, fields and timestamp", line)
+		}
+		keys := splitUnescaped(parts[0], ',')
+		p := linePoint{measurement: unescape(keys[0]), tags: map[string]string{}, fields: map[string]string{}, timestamp: parts[2]}
+		for _, tag := range keys[1:] {
+			kv := splitUnescaped(tag, '=')
+			if len(kv) != 2 {
+				t.Fatalf("tag %q isn't a key and value", tag)
+			}
+			p.tags[unescape(kv[0])] = unescape(kv[1])
+		}
+		for _, field := range splitUnescaped(parts[1], ',') {
+			kv := splitUnescaped(field, '=')
+			p.fields[kv[0]] = kv[1]
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+func TestInfluxDB(t *testing.T) {
+	at := time.Unix(1600000000, 123456789)
+	tests := []struct {
+		name       string
+		backend    InfluxDB
+		points     []Point
+		want       []linePoint
+		wantHeader map[string]string
+	}{
+		{
+			name:    "points",
+			backend: InfluxDB{Measurement: "temperature"},
+			points: []Point{
+				{Device: "c4:7c:8d:6a:1f:2b", Probe: 0, Name: "pit", Session: "brisket", Time: at, Temperature: 110.5},
+				{Device: "c4:7c:8d:6a:1f:2b", Probe: 1, Name: "probe2", Time: at, Temperature: 70},
+			},
+			want: []linePoint{
+				{"temperature", map[string]string{"device": "c4:7c:8d:6a:1f:2b", "probe": "1", "name": "pit", "session": "brisket"},
+					map[string]string{"celsius": "110.5"}, "1600000000123456789"},
+				{"temperature", map[string]string{"device": "c4:7c:8d:6a:1f:2b", "probe": "2", "name": "probe2"},
+					map[string]string{"celsius": "70"}, "1600000000123456789"},
+			},
+			wantHeader: map[string]string{"Content-Type": "text/plain; charset=utf-8", "Authorization": ""},
+		},
+		{
+			name:    "escaping",
+			backend: InfluxDB{Measurement: "bbq temps,celsius"},
+			points:  []Point{{Device: "dev", Probe: 3, Name: "pork shoulder, left=1", Session: "a b", Time: at, Temperature: 65.25}},
+			want: []linePoint{
+				{"bbq temps,celsius", map[string]string{"device": "dev", "probe": "4", "name": "pork shoulder, left=1", "session": "a b"},
+					map[string]string{"celsius": "65.25"}, "1600000000123456789"},
+			},
+		},
+		{
+			name:       "token",
+			backend:    InfluxDB{Measurement: "temperature", Token: "secret"},
+			points:     []Point{{Device: "dev", Name: "pit", Time: at, Temperature: 100}},
+			want:       []linePoint{{"temperature", map[string]string{"device": "dev", "probe": "1", "name": "pit"}, map[string]string{"celsius": "100"}, "1600000000123456789"}},
+			wantHeader: map[string]string{"Authorization": "Token secret"},
+		},
+		{
+			name:       "basic auth",
+			backend:    InfluxDB{Measurement: "temperature", Username: "user", Password: "pass"},
+			points:     []Point{{Device: "dev", Name: "pit", Time: at, Temperature: 100}},
+			want:       []linePoint{{"temperature", map[string]string{"device": "dev", "probe": "1", "name": "pit"}, map[string]string{"celsius": "100"}, "1600000000123456789"}},
+			wantHeader: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := newServer(t, http.StatusNoContent)
+			defer server.Close()
+			backend := test.backend
+			backend.URL = server.URL + "/write?db=bbq"
+			if err := backend.Write(context.Background(), test.points); err != nil {
+				t.Fatal(err)
+			}
+			r := <-requests
+			if got := parseLineProtocol(t, string(r.body)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+			for name, want := range test.wantHeader {
+				if got := r.header.Get(name); got != want {
+					t.Errorf("got %s %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInfluxDBError(t *testing.T) {
+	server, _ := newServer(t, http.StatusBadRequest)
+	defer server.Close()
+	err := NewInfluxDB(server.URL).Write(context.Background(), []Point{{Device: "dev", Name: "pit", Temperature: 100}})
+	want := &HTTPError{StatusCode: http.StatusBadRequest, Body: "go away"}
+	if !reflect.DeepEqual(err, want) {
+		t.Fatalf("got %v, want %v", err, want)
+	}
+	if !rejected(err) {
+		t.Error("a bad request wasn't treated as a rejection")
+	}
+}
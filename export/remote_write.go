@@ -0,0 +1,162 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package export
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/golang/snappy"
+)
+
+// RemoteWrite writes points to a Prometheus remote-write endpoint, as the ibbq_temperature_celsius metric,
+// labelled with the device, probe number (from 1), probe name and session.
+type RemoteWrite struct {
+	// URL is the remote-write endpoint, e.g. http://localhost:9090/api/v1/write.
+	URL string
+	// Metric is the metric's name.
+	Metric string
+	// Labels are extra labels added to every series, e.g. {"job": "ibbq"}.
+	Labels map[string]string
+	// Username and Password, if set, are sent with basic authentication.
+	Username string
+	Password string
+	// BearerToken, if set, is sent as a bearer token.
+	BearerToken string
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewRemoteWrite creates a backend writing to the given remote-write endpoint.
+func NewRemoteWrite(url string) *RemoteWrite {
+	return &RemoteWrite{URL: url, Metric: "ibbq_temperature_celsius"}
+}
+
+type label struct {
+	name, value string
+}
+
+type series struct {
+	labels  []label
+	samples []Point
+}
+
+// Write writes the points, grouped into a series per probe.
+func (r *RemoteWrite) Write(ctx context.Context, points []Point) error {
+	var order []string
+	bySeries := map[string]*series{}
+	for _, p := range points {
+		labels := r.labels(p)
+		var key string
+		for _, l := range labels {
+			key += l.name + "\xff" + l.value + "\xff"
+		}
+		s, ok := bySeries[key]
+		if !ok {
+			s = &series{labels: labels}
+			bySeries[key] = s
+			order = append(order, key)
+		}
+		s.samples = append(s.samples, p)
+	}
+	var request []byte
+	for _, key := range order {
+		request = appendBytes(request, 1, encodeSeries(bySeries[key]))
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-protobuf")
+	header.Set("Content-Encoding", "snappy")
+	header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case r.BearerToken != "":
+		header.Set("Authorization", "Bearer "+r.BearerToken)
+	case r.Username != "":
+		header.Set("Authorization", basicAuth(r.Username, r.Password))
+	}
+	return post(ctx, r.Client, r.URL, header, snappy.Encode(nil, request))
+}
+
+// labels returns the point's labels, sorted by name as remote write requires.
+func (r *RemoteWrite) labels(p Point) []label {
+	labels := []label{
+		{"__name__", r.Metric},
+		{"device", p.Device},
+		{"probe", strconv.Itoa(p.Probe + 1)},
+		{"name", p.Name},
+	}
+	if p.Session != "" {
+		labels = append(labels, label{"session", p.Session})
+	}
+	for name, value := range r.Labels {
+		labels = append(labels, label{name, value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels
+}
+
+// The protobuf messages are encoded by hand, rather than pulling in a protobuf library for three messages:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeSeries(s *series) []byte {
+	var b []byte
+	for _, l := range s.labels {
+		var encoded []byte
+		encoded = appendBytes(encoded, 1, []byte(l.name))
+		encoded = appendBytes(encoded, 2, []byte(l.value))
+		b = appendBytes(b, 1, encoded)
+	}
+	// samples must be in time order within a series
+	sort.SliceStable(s.samples, func(i, j int) bool { return s.samples[i].Time.Before(s.samples[j].Time) })
+	for _, p := range s.samples {
+		var encoded []byte
+		encoded = appendKey(encoded, 1, 1)
+		encoded = appendFixed64(encoded, math.Float64bits(p.Temperature))
+		encoded = appendKey(encoded, 2, 0)
+		encoded = appendUvarint(encoded, uint64(p.Time.UnixNano()/1e6))
+		b = appendBytes(b, 2, encoded)
+	}
+	return b
+}
+
+// appendKey appends a field's key, made of its number and wire type.
+func appendKey(b []byte, field int, wireType int) []byte {
+	return appendUvarint(b, uint64(field<<3|wireType))
+}
+
+// appendBytes appends a length-delimited field.
+func appendBytes(b []byte, field int, value []byte) []byte {
+	b = appendKey(b, field, 2)
+	b = appendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+func appendFixed64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
@@ -0,0 +1,204 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package export
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+type decodedSample struct {
+	value     float64
+	timestamp int64
+}
+
+type decodedSeries struct {
+	labels  []label
+	samples []decodedSample
+}
+
+// protoField is a field decoded from a protobuf message. Varints and fixed64s are in number, the rest in bytes.
+type protoField struct {
+	field  int
+	number uint64
+	bytes  []byte
+}
+
+// decodeMessage decodes the fields of a protobuf message, supporting the wire types remote write uses.
+func decodeMessage(t *testing.T, b []byte) []protoField {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad key in %x", b)
+		}
+		b = b[n:]
+		f := protoField{field: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			if f.number, n = binary.Uvarint(b); n <= 0 {
+				t.Fatalf("bad varint in %x", b)
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				t.Fatalf("short fixed64 in %x", b)
+			}
+			f.number = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				t.Fatalf("bad length in %x", b)
+			}
+			f.bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// decodeWriteRequest decompresses and decodes a remote-write request.
+func decodeWriteRequest(t *testing.T, body []byte) []decodedSeries {
+	request, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []decodedSeries
+	for _, timeseries := range decodeMessage(t, request) {
+		if timeseries.field != 1 {
+			t.Fatalf("unexpected field %d in write request", timeseries.field)
+		}
+		var s decodedSeries
+		for _, f := range decodeMessage(t, timeseries.bytes) {
+			switch f.field {
+			case 1:
+				var l label
+				for _, lf := range decodeMessage(t, f.bytes) {
+					if lf.field == 1 {
+						l.name = string(lf.bytes)
+					} else {
+						l.value = string(lf.bytes)
+					}
+				}
+				s.labels = append(s.labels, l)
+			case 2:
+				var sample decodedSample
+				for _, sf := range decodeMessage(t, f.bytes) {
+					if sf.field == 1 {
+						sample.value = math.Float64frombits(sf.number)
+					} else {
+						sample.timestamp = int64(sf.number)
+					}
+				}
+				s.samples = append(s.samples, sample)
+			}
+		}
+		decoded = append(decoded, s)
+	}
+	return decoded
+}
+
+func TestRemoteWrite(t *testing.T) {
+	at := time.Unix(1600000000, 0)
+	points := []Point{
+		{Device: "dev", Probe: 0, Name: "pit", Session: "brisket", Time: at.Add(time.Second), Temperature: 111},
+		{Device: "dev", Probe: 1, Name: "probe2", Time: at, Temperature: 70.5},
+		{Device: "dev", Probe: 0, Name: "pit", Session: "brisket", Time: at, Temperature: 110},
+	}
+	tests := []struct {
+		name       string
+		backend    RemoteWrite
+		want       []decodedSeries
+		wantHeader map[string]string
+	}{
+		{
+			name:    "series",
+			backend: RemoteWrite{Metric: "ibbq_temperature_celsius"},
+			want: []decodedSeries{
+				{
+					labels: []label{{"__name__", "ibbq_temperature_celsius"}, {"device", "dev"}, {"name", "pit"}, {"probe", "1"}, {"session", "brisket"}},
+					// samples are sorted by time
+					samples: []decodedSample{{110, 1600000000000}, {111, 1600000001000}},
+				},
+				{
+					labels:  []label{{"__name__", "ibbq_temperature_celsius"}, {"device", "dev"}, {"name", "probe2"}, {"probe", "2"}},
+					samples: []decodedSample{{70.5, 1600000000000}},
+				},
+			},
+			wantHeader: map[string]string{
+				"Content-Type":                      "application/x-protobuf",
+				"Content-Encoding":                  "snappy",
+				"X-Prometheus-Remote-Write-Version": "0.1.0",
+				"Authorization":                     "",
+			},
+		},
+		{
+			name:    "extra labels",
+			backend: RemoteWrite{Metric: "bbq", Labels: map[string]string{"job": "ibbq", "zone": "garden"}, BearerToken: "secret"},
+			want: []decodedSeries{
+				{
+					labels:  []label{{"__name__", "bbq"}, {"device", "dev"}, {"job", "ibbq"}, {"name", "pit"}, {"probe", "1"}, {"session", "brisket"}, {"zone", "garden"}},
+					samples: []decodedSample{{110, 1600000000000}, {111, 1600000001000}},
+				},
+				{
+					labels:  []label{{"__name__", "bbq"}, {"device", "dev"}, {"job", "ibbq"}, {"name", "probe2"}, {"probe", "2"}, {"zone", "garden"}},
+					samples: []decodedSample{{70.5, 1600000000000}},
+				},
+			},
+			wantHeader: map[string]string{"Authorization": "Bearer secret"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := newServer(t, http.StatusNoContent)
+			defer server.Close()
+			backend := test.backend
+			backend.URL = server.URL + "/api/v1/write"
+			if err := backend.Write(context.Background(), append([]Point(nil), points...)); err != nil {
+				t.Fatal(err)
+			}
+			r := <-requests
+			if got := decodeWriteRequest(t, r.body); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+			for name, want := range test.wantHeader {
+				if got := r.header.Get(name); got != want {
+					t.Errorf("got %s %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteWriteUnavailable(t *testing.T) {
+	server, _ := newServer(t, http.StatusServiceUnavailable)
+	defer server.Close()
+	err := NewRemoteWrite(server.URL).Write(context.Background(), []Point{{Device: "dev", Name: "pit", Temperature: 100}})
+	if err == nil || rejected(err) {
+		t.Fatalf("got %v, want an error to retry", err)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-ble/ble"
+)
+
+// fakeDevice is a Bluetooth adapter which finds a single fake thermometer.
+type fakeDevice struct {
+	ble.Device
+	// hideThermometer makes scans run until they are cancelled without finding anything.
+	hideThermometer bool
+	// blockDial makes dialling wait until it is cancelled.
+	blockDial bool
+	// blockLogin makes the login write wait until the connection is cancelled.
+	blockLogin bool
+
+	mu      sync.Mutex
+	clients []*fakeClient
+	stopped int
+}
+
+func (d *fakeDevice) Scan(ctx context.Context, allowDup bool, h ble.AdvHandler) error {
+	if !d.hideThermometer {
+		h(fakeAdvertisement{})
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (d *fakeDevice) Dial(ctx context.Context, a ble.Addr) (ble.Client, error) {
+	if d.blockDial {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	client := &fakeClient{
+		blockLogin:    d.blockLogin,
+		subscriptions: make(map[string]ble.NotificationHandler),
+		disconnected:  make(chan struct{}),
+	}
+	d.mu.Lock()
+	d.clients = append(d.clients, client)
+	d.mu.Unlock()
+	return client, nil
+}
+
+func (d *fakeDevice) Stop() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped++
+	return nil
+}
+
+// dialled returns how many connections have been made.
+func (d *fakeDevice) dialled() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.clients)
+}
+
+// stops returns how many times the device has been stopped.
+func (d *fakeDevice) stops() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopped
+}
+
+// client returns the most recent connection.
+func (d *fakeDevice) client() *fakeClient {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.clients) == 0 {
+		return nil
+	}
+	return d.clients[len(d.clients)-1]
+}
+
+// fakeAdvertisement is the advertisement of the fake thermometer.
+type fakeAdvertisement struct {
+	ble.Advertisement
+}
+
+func (fakeAdvertisement) LocalName() string { return DeviceName }
+func (fakeAdvertisement) Connectable() bool { return true }
+func (fakeAdvertisement) RSSI() int         { return -60 }
+func (fakeAdvertisement) Addr() ble.Addr    { return ble.NewAddr("c4:7c:8d:6a:1f:2b") }
+
+// fakeClient is a connection to the fake thermometer. It answers battery requests,
+// and sends real-time data whenever it's asked to.
+type fakeClient struct {
+	ble.Client
+	blockLogin bool
+
+	// ack is the value read back from a characteristic.
+	ack []byte
+
+	mu            sync.Mutex
+	subscriptions map[string]ble.NotificationHandler
+	writes        [][]byte
+	reads         int
+	cancelOnce    sync.Once
+	disconnected  chan struct{}
+}
+
+func (c *fakeClient) Addr() ble.Addr { return fakeAdvertisement{}.Addr() }
+
+func (c *fakeClient) DiscoverProfile(force bool) (*ble.Profile, error) {
+	service := &ble.Service{UUID: ble.MustParse("fff0")}
+	for _, uuid := range []string{SettingResult, AccountAndVerify, HistoryData, RealTimeData, SettingData} {
+		service.Characteristics = append(service.Characteristics, &ble.Characteristic{UUID: ble.MustParse(uuid)})
+	}
+	return &ble.Profile{Services: []*ble.Service{service}}, nil
+}
+
+func (c *fakeClient) Subscribe(characteristic *ble.Characteristic, ind bool, h ble.NotificationHandler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions[characteristic.UUID.String()] = h
+	return nil
+}
+
+func (c *fakeClient) WriteCharacteristic(characteristic *ble.Characteristic, value []byte, noRsp bool) error {
+	if characteristic.UUID.Equal(ble.MustParse(AccountAndVerify)) && c.blockLogin {
+		<-c.disconnected
+		return errors.New("connection cancelled")
+	}
+	select {
+	case <-c.disconnected:
+		return errors.New("not connected")
+	default:
+	}
+	c.mu.Lock()
+	c.writes = append(c.writes, append([]byte(nil), value...))
+	c.mu.Unlock()
+	switch string(value) {
+	case string(batteryLevel):
+		c.notify(SettingResult, []byte{0x24, 0x10, 0x0e, 0x68, 0x10, 0x00})
+	case string(realTimeDataEnable):
+		c.notify(RealTimeData, []byte{0xe8, 0x03, 0x66, 0xff})
+	}
+	return nil
+}
+
+// notify sends a notification on the characteristic, if it has been subscribed to.
+func (c *fakeClient) notify(uuid string, data []byte) {
+	c.mu.Lock()
+	h := c.subscriptions[ble.MustParse(uuid).String()]
+	c.mu.Unlock()
+	if h != nil {
+		h(data)
+	}
+}
+
+// wrote reports whether the value has been written to the device.
+func (c *fakeClient) wrote(value []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, w := range c.writes {
+		if string(w) == string(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *fakeClient) ReadCharacteristic(characteristic *ble.Characteristic) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reads++
+	return c.ack, nil
+}
+
+func (c *fakeClient) ReadRSSI() int { return -70 }
+
+func (c *fakeClient) CancelConnection() error {
+	c.cancelOnce.Do(func() { close(c.disconnected) })
+	return nil
+}
+
+func (c *fakeClient) Disconnected() <-chan struct{} { return c.disconnected }
@@ -0,0 +1,175 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Filter processes the temperatures read from a single probe, e.g. to smooth out noise.
+// Filters keep state between readings, so each probe needs its own instance.
+type Filter interface {
+	// Filter takes a temperature, in celsius, and returns the processed temperature.
+	Filter(t time.Time, temperature float64) float64
+}
+
+// FilterFunc adapts a function to the Filter interface.
+type FilterFunc func(t time.Time, temperature float64) float64
+
+// Filter calls f.
+func (f FilterFunc) Filter(t time.Time, temperature float64) float64 {
+	return f(t, temperature)
+}
+
+// FilterFactory creates a filter for a probe.
+type FilterFactory func() Filter
+
+// FilterConfiguration configures the filters applied to each probe's readings.
+type FilterConfiguration struct {
+	// Default creates the filter for probes which don't have an entry in Probes. Nil leaves them unfiltered.
+	Default FilterFactory
+	// Probes creates the filters for individual probes, keyed by probe index.
+	Probes map[int]FilterFactory
+}
+
+func (c FilterConfiguration) factory(probe int) FilterFactory {
+	if factory, ok := c.Probes[probe]; ok {
+		return factory
+	}
+	return c.Default
+}
+
+// Chain creates filters which pass each temperature through the given filters in turn.
+func Chain(factories ...FilterFactory) FilterFactory {
+	return func() Filter {
+		filters := make([]Filter, len(factories))
+		for i, factory := range factories {
+			filters[i] = factory()
+		}
+		return FilterFunc(func(t time.Time, temperature float64) float64 {
+			for _, filter := range filters {
+				temperature = filter.Filter(t, temperature)
+			}
+			return temperature
+		})
+	}
+}
+
+// ExponentialMovingAverage creates filters which smooth temperatures with an exponential moving average.
+// Alpha, between 0 and 1, is the weight given to each new temperature; smaller values smooth more.
+func ExponentialMovingAverage(alpha float64) FilterFactory {
+	return func() Filter {
+		var average float64
+		initialized := false
+		return FilterFunc(func(t time.Time, temperature float64) float64 {
+			if !initialized {
+				average = temperature
+				initialized = true
+			} else {
+				average = alpha*temperature + (1-alpha)*average
+			}
+			return average
+		})
+	}
+}
+
+// MedianOfN creates filters which return the median of the last n temperatures.
+func MedianOfN(n int) FilterFactory {
+	if n < 1 {
+		n = 1
+	}
+	return func() Filter {
+		window := make([]float64, 0, n)
+		sorted := make([]float64, 0, n)
+		return FilterFunc(func(t time.Time, temperature float64) float64 {
+			if len(window) == n {
+				window = window[1:]
+			}
+			window = append(window, temperature)
+			sorted = append(sorted[:0], window...)
+			sort.Float64s(sorted)
+			middle := len(sorted) / 2
+			if len(sorted)%2 == 0 {
+				return (sorted[middle-1] + sorted[middle]) / 2
+			}
+			return sorted[middle]
+		})
+	}
+}
+
+// SpikeRejection creates filters which discard temperatures differing from the last accepted temperature
+// by more than threshold degrees, returning the last accepted temperature instead.
+// After maxRejections consecutive rejections the change is taken to be real and accepted.
+func SpikeRejection(threshold float64, maxRejections int) FilterFactory {
+	return func() Filter {
+		var accepted float64
+		initialized := false
+		rejections := 0
+		return FilterFunc(func(t time.Time, temperature float64) float64 {
+			if initialized && math.Abs(temperature-accepted) > threshold && rejections < maxRejections {
+				rejections++
+				return accepted
+			}
+			accepted = temperature
+			initialized = true
+			rejections = 0
+			return accepted
+		})
+	}
+}
+
+// pipeline applies the configured filters to each reading.
+type pipeline struct {
+	mu      sync.Mutex
+	config  FilterConfiguration
+	filters map[int]Filter
+}
+
+func newPipeline(config FilterConfiguration) *pipeline {
+	return &pipeline{
+		config:  config,
+		filters: map[int]Filter{},
+	}
+}
+
+// process fills in the filtered temperatures of a reading from its raw temperatures.
+// Unplugged probes are passed through unfiltered, and their filters start afresh once they are plugged back in.
+func (p *pipeline) process(reading Reading) Reading {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reading.Temperatures = make([]float64, len(reading.Raw))
+	for i, temperature := range reading.Raw {
+		reading.Temperatures[i] = temperature
+		if !ProbeConnected(temperature) {
+			delete(p.filters, i)
+			continue
+		}
+		filter, ok := p.filters[i]
+		if !ok {
+			factory := p.config.factory(i)
+			if factory == nil {
+				continue
+			}
+			filter = factory()
+			p.filters[i] = filter
+		}
+		reading.Temperatures[i] = filter.Filter(reading.Time, temperature)
+	}
+	return reading
+}
@@ -0,0 +1,94 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		factory FilterFactory
+		in      []float64
+		want    []float64
+	}{
+		{"moving average", ExponentialMovingAverage(0.5), []float64{100, 110, 110, 90}, []float64{100, 105, 107.5, 98.75}},
+		{"moving average without smoothing", ExponentialMovingAverage(1), []float64{100, 110, 90}, []float64{100, 110, 90}},
+		{"median of three", MedianOfN(3), []float64{100, 200, 101, 102, 50}, []float64{100, 150, 101, 102, 101}},
+		{"median of even window", MedianOfN(2), []float64{100, 110, 120}, []float64{100, 105, 115}},
+		{"median of less than one", MedianOfN(0), []float64{100, 110}, []float64{100, 110}},
+		{"spike rejected", SpikeRejection(10, 2), []float64{100, 150, 101, 102}, []float64{100, 100, 101, 102}},
+		{"spike accepted after max rejections", SpikeRejection(10, 2), []float64{100, 150, 151, 152, 153}, []float64{100, 100, 100, 152, 153}},
+		{"spike rejection without rejections", SpikeRejection(10, 0), []float64{100, 150}, []float64{100, 150}},
+		{"chain", Chain(SpikeRejection(10, 1), ExponentialMovingAverage(0.5)), []float64{100, 150, 110}, []float64{100, 100, 105}},
+		{"empty chain", Chain(), []float64{100, 150}, []float64{100, 150}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := test.factory()
+			at := time.Unix(1600000000, 0)
+			for i, temperature := range test.in {
+				if got := filter.Filter(at.Add(time.Duration(i)*time.Second), temperature); math.Abs(got-test.want[i]) > 1e-9 {
+					t.Errorf("temperature %d: got %v, want %v", i, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	average := ExponentialMovingAverage(0.5)
+	tests := []struct {
+		name   string
+		config FilterConfiguration
+		raw    [][]float64
+		want   [][]float64
+	}{
+		{"unfiltered", FilterConfiguration{}, [][]float64{{100, 50}, {110, 60}}, [][]float64{{100, 50}, {110, 60}}},
+		{"default", FilterConfiguration{Default: average}, [][]float64{{100, 50}, {110, 60}}, [][]float64{{100, 50}, {105, 55}}},
+		{"probe overrides default",
+			FilterConfiguration{Default: average, Probes: map[int]FilterFactory{1: nil}},
+			[][]float64{{100, 50}, {110, 60}},
+			[][]float64{{100, 50}, {105, 60}}},
+		{"each probe has its own filter",
+			FilterConfiguration{Probes: map[int]FilterFactory{0: average, 1: average}},
+			[][]float64{{100, 50}, {110, 50}},
+			[][]float64{{100, 50}, {105, 50}}},
+		{"unplugged probes restart their filters",
+			FilterConfiguration{Default: average},
+			[][]float64{{100}, {110}, {UnpluggedTemperature}, {20}, {30}},
+			[][]float64{{100}, {105}, {UnpluggedTemperature}, {20}, {25}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newPipeline(test.config)
+			at := time.Unix(1600000000, 0)
+			for i, raw := range test.raw {
+				reading := p.process(Reading{Time: at.Add(time.Duration(i) * time.Second), Raw: raw})
+				if !reflect.DeepEqual(reading.Temperatures, test.want[i]) {
+					t.Errorf("reading %d: got %v, want %v", i, reading.Temperatures, test.want[i])
+				}
+				if !reflect.DeepEqual(reading.Raw, raw) {
+					t.Errorf("reading %d: raw temperatures changed to %v", i, reading.Raw)
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,15 @@ module github.com/sworisbreathing/go-ibbq/v2
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/go-ble/ble v0.0.0-20181002102605-e78417b510a3
+	github.com/golang/snappy v0.0.1
 	github.com/mattn/go-colorable v0.1.1 // indirect
 	github.com/mattn/go-isatty v0.0.7 // indirect
 	github.com/mgutz/ansi v0.0.0-20170206155736-9520e82c474b // indirect
 	github.com/mgutz/logxi v0.0.0-20161027140823-aebf8a7d67ab
 	github.com/pkg/errors v0.8.1 // indirect
 	github.com/raff/goble v0.0.0-20190228063054-5a206277e735 // indirect
-	github.com/stretchr/testify v1.3.0 // indirect
+	go.etcd.io/bbolt v1.3.5
+	go.uber.org/goleak v1.1.12
 )
@@ -0,0 +1,122 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+const (
+	temperatureReceivedHandlerName  = "temperatureReceived"
+	batteryLevelReceivedHandlerName = "batteryLevelReceived"
+	batteryHandlerName              = "battery"
+	statusUpdatedHandlerName        = "statusUpdated"
+	disconnectedHandlerName         = "disconnected"
+	signalStrengthHandlerName       = "signalStrength"
+	readingHandlerName              = "reading"
+	fullRateReadingHandlerName      = "fullRateReading"
+)
+
+// ErrorHandler is a callback for errors which can't be returned to a caller,
+// such as panics recovered from handlers.
+type ErrorHandler func(error)
+
+// HandlerPanicError reports a panic recovered from a handler.
+type HandlerPanicError struct {
+	// Handler names the handler which panicked, e.g. "temperatureReceived".
+	Handler string
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *HandlerPanicError) Error() string {
+	return fmt.Sprintf("%s handler panicked: %v", e.Handler, e.Value)
+}
+
+// handlerGuard isolates us from panicking handlers.
+type handlerGuard struct {
+	mu           sync.Mutex
+	maxPanics    int
+	panics       map[string]int
+	errorHandler ErrorHandler
+}
+
+func newHandlerGuard(maxPanics int) *handlerGuard {
+	return &handlerGuard{
+		maxPanics: maxPanics,
+		panics:    map[string]int{},
+	}
+}
+
+// invoke calls f, recovering and reporting any panic.
+// Once a handler has panicked maxPanics times in a row, it is no longer called.
+func (g *handlerGuard) invoke(name string, f func()) {
+	if g.disabled(name) {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Recovered from panic in handler", "handler", name, "panic", r)
+			g.panicked(name)
+			g.reportError(&HandlerPanicError{Handler: name, Value: r, Stack: debug.Stack()})
+		}
+	}()
+	f()
+	g.mu.Lock()
+	g.panics[name] = 0
+	g.mu.Unlock()
+}
+
+func (g *handlerGuard) disabled(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.maxPanics > 0 && g.panics[name] >= g.maxPanics
+}
+
+func (g *handlerGuard) panicked(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.panics[name]++
+	if g.maxPanics > 0 && g.panics[name] == g.maxPanics {
+		logger.Error("Disabling handler after consecutive panics", "handler", name, "panics", g.maxPanics)
+	}
+}
+
+func (g *handlerGuard) setErrorHandler(errorHandler ErrorHandler) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.errorHandler = errorHandler
+}
+
+// reportError passes err to the error handler, if there is one.
+func (g *handlerGuard) reportError(err error) {
+	g.mu.Lock()
+	errorHandler := g.errorHandler
+	g.mu.Unlock()
+	if errorHandler == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Recovered from panic in error handler", "panic", r)
+		}
+	}()
+	errorHandler(err)
+}
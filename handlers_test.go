@@ -0,0 +1,107 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import "testing"
+
+func TestHandlerGuard(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxPanics int
+		// outcomes has a 'p' for each call which panics, and a '.' for each which returns
+		outcomes string
+		// want has a 'c' for each call made, and a '-' for each skipped
+		want string
+		// errors is the number of panics reported to the error handler
+		errors int
+	}{
+		{"returns", 2, "...", "ccc", 0},
+		{"disabled after consecutive panics", 2, "pp..", "cc--", 2},
+		{"panics reset by a successful call", 2, "p.p.pp.", "cccccc-", 4},
+		{"never disabled", 0, "ppppp.", "cccccc", 5},
+		{"disabled after one panic", 1, "p.", "c-", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newHandlerGuard(test.maxPanics)
+			var errs []error
+			g.setErrorHandler(func(err error) { errs = append(errs, err) })
+			got := ""
+			for _, outcome := range test.outcomes {
+				called := false
+				g.invoke("test", func() {
+					called = true
+					if outcome == 'p' {
+						panic("boom")
+					}
+				})
+				if called {
+					got += "c"
+				} else {
+					got += "-"
+				}
+			}
+			if got != test.want {
+				t.Errorf("got calls %q, want %q", got, test.want)
+			}
+			if len(errs) != test.errors {
+				t.Errorf("got %d errors, want %d", len(errs), test.errors)
+			}
+		})
+	}
+}
+
+func TestHandlerPanicError(t *testing.T) {
+	g := newHandlerGuard(0)
+	var errs []error
+	g.setErrorHandler(func(err error) { errs = append(errs, err) })
+	g.invoke(temperatureReceivedHandlerName, func() { panic("boom") })
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1", len(errs))
+	}
+	err, ok := errs[0].(*HandlerPanicError)
+	if !ok {
+		t.Fatalf("got %T, want *HandlerPanicError", errs[0])
+	}
+	if err.Handler != temperatureReceivedHandlerName || err.Value != "boom" {
+		t.Errorf("got handler %q and value %v, want %q and boom", err.Handler, err.Value, temperatureReceivedHandlerName)
+	}
+	if len(err.Stack) == 0 {
+		t.Error("got an empty stack")
+	}
+	if want := "temperatureReceived handler panicked: boom"; err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+}
+
+func TestPanickingErrorHandler(t *testing.T) {
+	g := newHandlerGuard(0)
+	reported := 0
+	g.setErrorHandler(func(err error) {
+		reported++
+		panic("error handler")
+	})
+	g.invoke("test", func() { panic("boom") })
+	g.reportError(&HandlerPanicError{Handler: "test"})
+	if reported != 2 {
+		t.Errorf("error handler called %d times, want 2", reported)
+	}
+	called := false
+	g.invoke("test", func() { called = true })
+	if !called {
+		t.Error("handler not called after the error handler panicked")
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -31,24 +33,52 @@ type Ibbq struct {
 	ctx                         context.Context
 	config                      Configuration
 	device                      ble.Device
+	sharedDevice                *SharedDevice
 	disconnectedHandler         DisconnectedHandler
 	temperatureReceivedHandler  TemperatureReceivedHandler
 	batteryLevelReceivedHandler BatteryLevelReceivedHandler
+	batteryHandler              BatteryHandler
 	statusUpdatedHandler        StatusUpdatedHandler
-	client                      ble.Client
-	profile                     *ble.Profile
-	disconnected                chan struct{}
-	status                      Status
+	signalStrengthHandler       SignalStrengthHandler
+	readingHandler              ReadingHandler
+	fullRateReadingHandler      ReadingHandler
+	pipeline                    *pipeline
+	deadband                    *deadband
+	lifecycle                   *lifecycle
+	state                       *state
+	guard                       *handlerGuard
+	dispatcher                  *dispatcher
+	duty                        *dutyCycle
 }
 
 // TemperatureReceivedHandler is a callback for temperature readings.
 // All temperature readings are returned in celsius.
 type TemperatureReceivedHandler func([]float64)
 
+// ReadingHandler is a callback for timestamped temperature readings.
+type ReadingHandler func(Reading)
+
+// Suppressor reports whether readings should currently be discounted, e.g. while the cooker's lid is open.
+type Suppressor interface {
+	Suppressed() bool
+}
+
+// ReadingHandlers combines reading handlers into one, which calls each of them in turn.
+func ReadingHandlers(handlers ...ReadingHandler) ReadingHandler {
+	return func(reading Reading) {
+		for _, handler := range handlers {
+			handler(reading.copy())
+		}
+	}
+}
+
 // BatteryLevelReceivedHandler is a callback for battery readings.
 // All battery readings are returned as percentages.
 type BatteryLevelReceivedHandler func(int)
 
+// BatteryHandler is a callback for battery readings, including the voltage and the effect of sampling.
+type BatteryHandler func(Battery)
+
 // DisconnectedHandler handles disconnection events
 type DisconnectedHandler func()
 
@@ -57,77 +87,142 @@ type StatusUpdatedHandler func(Status)
 
 // NewIbbq creates a new Ibbq
 func NewIbbq(ctx context.Context, config Configuration, disconnectedHandler DisconnectedHandler, temperatureReceivedHandler TemperatureReceivedHandler, batteryLevelReceivedHandler BatteryLevelReceivedHandler, statusUpdatedHandler StatusUpdatedHandler) (ibbq Ibbq, err error) {
-	d, err := NewDevice("default")
-	ble.SetDefaultDevice(d)
-	return Ibbq{ctx, config, d, disconnectedHandler, temperatureReceivedHandler, batteryLevelReceivedHandler, statusUpdatedHandler, nil, nil, nil, Disconnected}, err
+	var d ble.Device
+	if config.SharedDevice != nil {
+		d = config.SharedDevice.Device
+	} else {
+		if d, err = NewDevice(config.Backend, config.deviceOptions()...); err != nil {
+			return Ibbq{}, err
+		}
+		ble.SetDefaultDevice(d)
+	}
+	guard := newHandlerGuard(config.MaxHandlerPanics)
+	ctx, cancel := context.WithCancel(ctx)
+	return Ibbq{
+		ctx:                         ctx,
+		config:                      config,
+		device:                      d,
+		sharedDevice:                config.SharedDevice,
+		disconnectedHandler:         disconnectedHandler,
+		temperatureReceivedHandler:  temperatureReceivedHandler,
+		batteryLevelReceivedHandler: batteryLevelReceivedHandler,
+		statusUpdatedHandler:        statusUpdatedHandler,
+		lifecycle:                   &lifecycle{cancel: cancel},
+		pipeline:                    newPipeline(config.Filters),
+		deadband:                    newDeadband(config.Deadband),
+		state:                       newState(),
+		guard:                       guard,
+		dispatcher:                  newDispatcher(config.DispatchMode, config.DispatchQueueSize, guard),
+		duty:                        &dutyCycle{},
+	}, err
+}
+
+// SetErrorHandler registers a callback for errors which can't be returned to a caller,
+// such as panics recovered from the other handlers. It should be called before Connect.
+func (ibbq *Ibbq) SetErrorHandler(errorHandler ErrorHandler) {
+	ibbq.guard.setErrorHandler(errorHandler)
+}
+
+// SetReadingHandler registers a callback for timestamped temperature readings.
+// Like the temperature received handler, it only receives readings which pass the deadband filter.
+// It should be called before Connect.
+func (ibbq *Ibbq) SetReadingHandler(readingHandler ReadingHandler) {
+	ibbq.readingHandler = readingHandler
+}
+
+// SetFullRateReadingHandler registers a callback for every temperature reading received from the device,
+// regardless of the deadband filter. It should be called before Connect.
+func (ibbq *Ibbq) SetFullRateReadingHandler(fullRateReadingHandler ReadingHandler) {
+	ibbq.fullRateReadingHandler = fullRateReadingHandler
+}
+
+// SetBatteryHandler registers a callback for battery readings. Unlike the battery level received handler,
+// it receives the voltage, and how much of the time real-time data was being sent,
+// so that the effect of the sampling mode on battery life can be followed. It should be called before Connect.
+func (ibbq *Ibbq) SetBatteryHandler(batteryHandler BatteryHandler) {
+	ibbq.batteryHandler = batteryHandler
+}
+
+// Status returns the current connection status.
+func (ibbq *Ibbq) Status() Status {
+	return ibbq.state.getStatus()
 }
 
-func (ibbq *Ibbq) handleDisconnects() {
-	logger.Debug("waiting for disconnect")
-	<-ibbq.client.Disconnected()
-	logger.Info("Disconnected", "addr", ibbq.client.Addr().String())
-	ibbq.client = nil
-	ibbq.profile = nil
-	ibbq.device.Stop()
-	ibbq.updateStatus(Disconnected)
-	go ibbq.disconnectedHandler()
+// Address returns the address of the device most recently connected to, or an empty string if there hasn't been one.
+func (ibbq *Ibbq) Address() string {
+	return ibbq.state.getAddress()
 }
 
-func (ibbq *Ibbq) handleContextClosed() {
-	logger.Debug("waiting for context to close")
-	<-ibbq.ctx.Done()
-	ibbq.Disconnect(false)
+// LastReading returns the most recent temperature reading, if any has been received.
+func (ibbq *Ibbq) LastReading() (Reading, bool) {
+	return ibbq.state.lastReading()
 }
 
-// Connect connects to an ibbq
+// LastBattery returns the most recent battery reading, if any has been received.
+func (ibbq *Ibbq) LastBattery() (Battery, bool) {
+	return ibbq.state.lastBattery()
+}
+
+// RequestBatteryLevel asks the device for its battery level and waits for the result.
+func (ibbq *Ibbq) RequestBatteryLevel(ctx context.Context) (Battery, error) {
+	if ibbq.currentSession() == nil {
+		return Battery{}, errors.New("Not connected")
+	}
+	waiter := ibbq.state.awaitBattery()
+	logger.Debug("Requesting battery data")
+	if err := ibbq.writeSetting(batteryLevel); err != nil {
+		ibbq.state.cancelBatteryWait(waiter)
+		return Battery{}, err
+	}
+	select {
+	case battery := <-waiter:
+		return battery, nil
+	case <-ctx.Done():
+		ibbq.state.cancelBatteryWait(waiter)
+		return Battery{}, ctx.Err()
+	}
+}
+
+// DispatchStats reports on the handler dispatch queue.
+func (ibbq *Ibbq) DispatchStats() DispatchStats {
+	return ibbq.dispatcher.snapshot()
+}
+
+// dispatch runs a handler asynchronously, isolating us from any panic it raises.
+func (ibbq *Ibbq) dispatch(name string, f func()) {
+	ibbq.dispatcher.dispatch(name, f)
+}
+
+func (ibbq *Ibbq) notifyDisconnected() {
+	if ibbq.disconnectedHandler != nil {
+		ibbq.dispatch(disconnectedHandlerName, ibbq.disconnectedHandler)
+	}
+}
+
+// Connect connects to an ibbq. It returns ErrClosed once the Ibbq has been closed,
+// and an error without connecting if the sampling configuration is invalid.
 func (ibbq *Ibbq) Connect() error {
-	var client ble.Client
 	var err error
+	if ibbq.isClosed() {
+		return ErrClosed
+	}
+	if err = ibbq.config.validate(); err != nil {
+		return err
+	}
 	timeoutContext, cancel := context.WithTimeout(ibbq.ctx, ibbq.config.ConnectTimeout)
 	defer cancel()
-	c := make(chan interface{})
+	c := make(chan error, 1)
 	logger.Info("Connecting to device")
-	go func() {
-		ibbq.updateStatus(Connecting)
-		if client, err = ble.Connect(timeoutContext, filter()); err == nil {
-			logger.Info("Connected to device", "addr", client.Addr())
-			ibbq.client = client
-			logger.Debug("Setting up disconnect handler")
-			go ibbq.handleDisconnects()
-			logger.Debug("Setting up context closed handler")
-			go ibbq.handleContextClosed()
-			err = ibbq.discoverProfile()
-		}
-		if err == nil {
-			err = ibbq.login()
-		}
-		if err == nil {
-			err = ibbq.subscribeToSettingResults()
-		}
-		if err == nil {
-			err = ibbq.ConfigureTemperatureCelsius()
-		}
-		if err == nil {
-			err = ibbq.subscribeToRealTimeData()
-		}
-		if err == nil {
-			err = ibbq.subscribeToHistoryData()
-		}
-		if err == nil {
-			err = ibbq.enableRealTimeData()
-		}
-		if err == nil {
-			err = ibbq.enableBatteryData()
-		}
-		c <- err
-		close(c)
-	}()
+	ibbq.updateStatus(Connecting)
+	ibbq.goTracked(func() {
+		c <- ibbq.connect(timeoutContext)
+	})
 	select {
 	case <-timeoutContext.Done():
 		logger.Error("timeout while connecting")
 		err = timeoutContext.Err()
 		ibbq.updateStatus(Disconnected)
-	case err := <-c:
+	case err = <-c:
 		if err != nil {
 			logger.Error("Error received while connecting", "err", err)
 			ibbq.updateStatus(Disconnected)
@@ -138,44 +233,101 @@ func (ibbq *Ibbq) Connect() error {
 	return err
 }
 
-func (ibbq *Ibbq) discoverProfile() error {
-	var profile *ble.Profile
-	var err error
-	if profile, err = ibbq.client.DiscoverProfile(true); err == nil {
-		ibbq.profile = profile
+// connect establishes a session. If the session can't be set up, it is ended again.
+func (ibbq *Ibbq) connect(ctx context.Context) error {
+	var advertisedRSSI int
+	if ibbq.sharedDevice != nil {
+		ibbq.sharedDevice.connectMu.Lock()
+	}
+	client, err := dial(ctx, ibbq.device, func(a ble.Advertisement) bool {
+		if filter(ibbq.config.Address)(a) {
+			advertisedRSSI = a.RSSI()
+			return true
+		}
+		return false
+	})
+	if ibbq.sharedDevice != nil {
+		ibbq.sharedDevice.connectMu.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("Connected to device", "addr", client.Addr(), "rssi", advertisedRSSI)
+	ibbq.state.setAddress(client.Addr().String())
+	s := newSession(client)
+	if err = ibbq.discoverProfile(s); err == nil {
+		err = ibbq.startSession(s)
+	}
+	if err != nil {
+		client.CancelConnection()
+		return err
+	}
+	logger.Debug("Setting up disconnect handler")
+	ibbq.goTracked(func() { ibbq.handleDisconnects(s) })
+	logger.Debug("Setting up context closed handler")
+	ibbq.goTracked(func() { ibbq.handleContextClosed(s) })
+	err = ibbq.login(s)
+	if err == nil {
+		err = ibbq.subscribeToSettingResults(s)
+	}
+	if err == nil && !ibbq.config.KeepDisplayUnits {
+		err = ibbq.ConfigureTemperatureCelsius()
+	}
+	if err == nil {
+		err = ibbq.subscribeToRealTimeData(s)
+	}
+	if err == nil {
+		err = ibbq.subscribeToHistoryData(s)
+	}
+	if err == nil {
+		err = ibbq.enableRealTimeData(s)
+	}
+	if err == nil {
+		err = ibbq.enableBatteryData(s)
+	}
+	if err == nil {
+		ibbq.startSignalStrengthPolling(s, advertisedRSSI)
+		err = ctx.Err()
+	}
+	if err != nil {
+		client.CancelConnection()
+		ibbq.endSession(s)
 	}
 	return err
 }
 
-func (ibbq *Ibbq) login() error {
+func (ibbq *Ibbq) discoverProfile(s *session) error {
+	var profile *ble.Profile
 	var err error
-	var uuid ble.UUID
-	if uuid, err = ble.Parse(AccountAndVerify); err == nil {
-		logger.Debug("logging in to device", "addr", ibbq.client.Addr(), "uuid", uuid)
-		characteristic := ble.NewCharacteristic(uuid)
-		if c := ibbq.profile.FindCharacteristic(characteristic); c != nil {
-			err = ibbq.client.WriteCharacteristic(c, Credentials, false)
-			logger.Debug("credentials written")
-		}
+	if profile, err = s.client.DiscoverProfile(true); err == nil {
+		s.profile = profile
 	}
 	return err
 }
 
+func (ibbq *Ibbq) login(s *session) error {
+	strategy := ibbq.config.LoginStrategy
+	if strategy == nil {
+		strategy = NewCredentialsLogin(Credentials)
+	}
+	return strategy.Login(s.client, s.profile)
+}
+
 func (ibbq *Ibbq) updateStatus(status Status) {
-	ibbq.status = status
+	ibbq.state.setStatus(status)
 	if ibbq.statusUpdatedHandler != nil {
-		go ibbq.statusUpdatedHandler(status)
+		ibbq.dispatch(statusUpdatedHandlerName, func() { ibbq.statusUpdatedHandler(status) })
 	}
 }
 
-func (ibbq *Ibbq) subscribeToRealTimeData() error {
+func (ibbq *Ibbq) subscribeToRealTimeData(s *session) error {
 	var err error
 	var uuid ble.UUID
 	logger.Info("Subscribing to real-time data")
 	if uuid, err = ble.Parse(RealTimeData); err == nil {
 		characteristic := ble.NewCharacteristic(uuid)
-		if c := ibbq.profile.FindCharacteristic(characteristic); c != nil {
-			err = ibbq.client.Subscribe(c, false, ibbq.realTimeDataReceived())
+		if c := s.profile.FindCharacteristic(characteristic); c != nil {
+			err = s.client.Subscribe(c, false, ibbq.realTimeDataReceived(s))
 			if err == nil {
 				logger.Info("Subscribed to real-time data")
 			} else {
@@ -188,9 +340,10 @@ func (ibbq *Ibbq) subscribeToRealTimeData() error {
 	return err
 }
 
-func (ibbq *Ibbq) realTimeDataReceived() ble.NotificationHandler {
+func (ibbq *Ibbq) realTimeDataReceived(s *session) ble.NotificationHandler {
 	return func(data []byte) {
 		logger.Debug("received real-time data", hex.EncodeToString(data))
+		received := time.Now()
 		probeCount := len(data) / 2
 		probeData := make([]float64, probeCount)
 		for i := range data {
@@ -198,18 +351,43 @@ func (ibbq *Ibbq) realTimeDataReceived() ble.NotificationHandler {
 				probeData[i/2] = float64(binary.LittleEndian.Uint16(data[i:i+2])) / 10
 			}
 		}
-		go ibbq.temperatureReceivedHandler(probeData)
+		reading := ibbq.pipeline.process(Reading{Time: received, Raw: probeData})
+		ibbq.state.setReading(reading)
+		select {
+		case s.sampled <- struct{}{}:
+		default:
+		}
+		ibbq.readingReceived(reading)
 	}
 }
 
-func (ibbq *Ibbq) subscribeToHistoryData() error {
+// readingReceived passes a reading to the handlers. Each handler gets its own copy of the temperatures.
+func (ibbq *Ibbq) readingReceived(reading Reading) {
+	if ibbq.fullRateReadingHandler != nil {
+		fullRateReading := reading.copy()
+		ibbq.dispatch(fullRateReadingHandlerName, func() { ibbq.fullRateReadingHandler(fullRateReading) })
+	}
+	if !ibbq.deadband.accept(reading) {
+		return
+	}
+	if ibbq.readingHandler != nil {
+		filteredReading := reading.copy()
+		ibbq.dispatch(readingHandlerName, func() { ibbq.readingHandler(filteredReading) })
+	}
+	if ibbq.temperatureReceivedHandler != nil {
+		temperatures := reading.copy().Temperatures
+		ibbq.dispatch(temperatureReceivedHandlerName, func() { ibbq.temperatureReceivedHandler(temperatures) })
+	}
+}
+
+func (ibbq *Ibbq) subscribeToHistoryData(s *session) error {
 	var err error
 	var uuid ble.UUID
 	logger.Info("Subscribing to history data")
 	if uuid, err = ble.Parse(HistoryData); err == nil {
 		characteristic := ble.NewCharacteristic(uuid)
-		if c := ibbq.profile.FindCharacteristic(characteristic); c != nil {
-			err = ibbq.client.Subscribe(c, false, ibbq.historyDataReceived())
+		if c := s.profile.FindCharacteristic(characteristic); c != nil {
+			err = s.client.Subscribe(c, false, ibbq.historyDataReceived())
 			if err == nil {
 				logger.Info("Subscribed to history data")
 			} else {
@@ -228,14 +406,14 @@ func (ibbq *Ibbq) historyDataReceived() ble.NotificationHandler {
 	}
 }
 
-func (ibbq *Ibbq) subscribeToSettingResults() error {
+func (ibbq *Ibbq) subscribeToSettingResults(s *session) error {
 	var err error
 	var uuid ble.UUID
 	logger.Info("Subscribing to setting results")
 	if uuid, err = ble.Parse(SettingResult); err == nil {
 		characteristic := ble.NewCharacteristic(uuid)
-		if c := ibbq.profile.FindCharacteristic(characteristic); c != nil {
-			err = ibbq.client.Subscribe(c, false, ibbq.settingResultReceived())
+		if c := s.profile.FindCharacteristic(characteristic); c != nil {
+			err = s.client.Subscribe(c, false, ibbq.settingResultReceived())
 			if err == nil {
 				logger.Info("Subscribed to setting results")
 			} else {
@@ -260,27 +438,52 @@ func (ibbq *Ibbq) settingResultReceived() ble.NotificationHandler {
 				maxVoltage = 65535
 			}
 			batteryPct := 100 * currentVoltage / maxVoltage
-			go ibbq.batteryLevelReceivedHandler(batteryPct)
+			received := time.Now()
+			samplingMode := ibbq.config.SamplingMode
+			if samplingMode == "" {
+				samplingMode = ContinuousSampling
+			}
+			battery := Battery{
+				Time:         received,
+				Percent:      batteryPct,
+				Voltage:      currentVoltage,
+				MaxVoltage:   maxVoltage,
+				SamplingMode: samplingMode,
+				RealTimeDuty: ibbq.duty.take(received),
+			}
+			ibbq.state.setBattery(battery)
+			if ibbq.batteryLevelReceivedHandler != nil {
+				ibbq.dispatch(batteryLevelReceivedHandlerName, func() { ibbq.batteryLevelReceivedHandler(batteryPct) })
+			}
+			if ibbq.batteryHandler != nil {
+				ibbq.dispatch(batteryHandlerName, func() { ibbq.batteryHandler(battery) })
+			}
 		}
 	}
 }
 
-func (ibbq *Ibbq) enableRealTimeData() error {
+func (ibbq *Ibbq) enableRealTimeData(s *session) error {
 	logger.Info("Enabling real-time data sending")
 	err := ibbq.writeSetting(realTimeDataEnable)
 	if err == nil {
+		ibbq.duty.set(true, time.Now())
 		logger.Info("Enabled real-time data sending")
+		switch ibbq.config.SamplingMode {
+		case IntervalSampling, AdaptiveSampling:
+			logger.Info("Sampling real-time data", "mode", ibbq.config.SamplingMode, "interval", ibbq.config.SamplingInterval)
+			ibbq.goTracked(func() { ibbq.runSampler(s) })
+		}
 	}
 	return err
 }
 
-func (ibbq *Ibbq) enableBatteryData() error {
+func (ibbq *Ibbq) enableBatteryData(s *session) error {
 	if ibbq.config.BatteryPollingInterval > 0 {
 		logger.Info("Enabling battery data sending")
 		var err error
 		if err = ibbq.writeSetting(batteryLevel); err == nil {
 			ticker := time.NewTicker(ibbq.config.BatteryPollingInterval)
-			go func() {
+			ibbq.goTracked(func() {
 				for {
 					select {
 					case <-ticker.C:
@@ -288,15 +491,16 @@ func (ibbq *Ibbq) enableBatteryData() error {
 						err := ibbq.writeSetting(batteryLevel)
 						if err != nil {
 							logger.Error("Unable to request battery level", "err", err)
+							ibbq.guard.reportError(err)
 							ticker.Stop()
 							return
 						}
-					case <-ibbq.client.Disconnected():
+					case <-s.done:
 						ticker.Stop()
 						return
 					}
 				}
-			}()
+			})
 		}
 		return err
 	}
@@ -326,13 +530,69 @@ func (ibbq *Ibbq) ConfigureTemperatureFahrenheit() error {
 	return err
 }
 
+// SetProbeAlarm sets the range of temperatures, in Celsius, outside which the device sounds its alarm for a probe.
+// Bounds beyond what the device can hold, such as infinities, are clamped to -3276.8 and 3276.7.
+// Use SetProbeHighAlarm to alarm only above a temperature.
+func (ibbq *Ibbq) SetProbeAlarm(probe int, low, high float64) error {
+	if low > high {
+		return errors.New("low temperature must not be above high temperature")
+	}
+	return ibbq.setProbeAlarm(probe, tenths(low), tenths(high))
+}
+
+// SetProbeHighAlarm sets the temperature, in Celsius, above which the device sounds its alarm for a probe,
+// with no low alarm.
+func (ibbq *Ibbq) SetProbeHighAlarm(probe int, high float64) error {
+	return ibbq.setProbeAlarm(probe, noLowAlarm, tenths(high))
+}
+
+// noLowAlarm is the lowest temperature the device can hold, in tenths of a degree, which its probes never read.
+const noLowAlarm = math.MinInt16
+
+func (ibbq *Ibbq) setProbeAlarm(probe int, low, high int16) error {
+	if probe < 0 || probe > 0xFF {
+		return fmt.Errorf("invalid probe %d", probe)
+	}
+	logger.Info("Configuring probe alarm", "probe", probe, "low", float64(low)/10, "high", float64(high)/10)
+	setting := []byte{0x01, byte(probe), 0x00, 0x00, 0x00, 0x00}
+	binary.LittleEndian.PutUint16(setting[2:], uint16(low))
+	binary.LittleEndian.PutUint16(setting[4:], uint16(high))
+	err := ibbq.writeSetting(setting)
+	if err == nil {
+		logger.Info("Configured probe alarm", "probe", probe)
+	}
+	return err
+}
+
+// tenths converts a temperature to the tenths of a degree the device uses, clamped to the range it can hold.
+func tenths(temperature float64) int16 {
+	t := math.Round(temperature * 10)
+	if t < math.MinInt16 {
+		return math.MinInt16
+	}
+	if t > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	return int16(t)
+}
+
+// SilenceAlarm silences the device's alarm, if it is sounding.
+func (ibbq *Ibbq) SilenceAlarm() error {
+	logger.Info("Silencing alarm")
+	return ibbq.writeSetting(silenceAlarm)
+}
+
 func (ibbq *Ibbq) writeSetting(settingValue []byte) error {
 	var err error
 	var uuid ble.UUID
+	s := ibbq.currentSession()
+	if s == nil || s.profile == nil {
+		return errors.New("Not connected")
+	}
 	if uuid, err = ble.Parse(SettingData); err == nil {
 		characteristic := ble.NewCharacteristic(uuid)
-		if c := ibbq.profile.FindCharacteristic(characteristic); c != nil {
-			err = ibbq.client.WriteCharacteristic(c, settingValue, false)
+		if c := s.profile.FindCharacteristic(characteristic); c != nil {
+			err = s.client.WriteCharacteristic(c, settingValue, false)
 		} else {
 			err = errors.New("Can't find characteristic for settings data")
 		}
@@ -340,35 +600,33 @@ func (ibbq *Ibbq) writeSetting(settingValue []byte) error {
 	return err
 }
 
-// Disconnect disconnects from an ibbq
+// Disconnect disconnects from an ibbq.
+// When force is set, the session is torn down without waiting for the device to acknowledge.
 func (ibbq *Ibbq) Disconnect(force bool) error {
 	var err error
-	if ibbq.client == nil {
+	s := ibbq.currentSession()
+	if s == nil {
 		err = errors.New("Not connected")
-		if ibbq.device != nil && force {
-			ibbq.client = nil
-			ibbq.profile = nil
-			err = ibbq.device.Stop()
+		if force {
+			err = ibbq.stopDevice()
 			ibbq.updateStatus(Disconnected)
-			go ibbq.disconnectedHandler()
 		}
 	} else {
 		logger.Info("Disconnecting")
 		ibbq.updateStatus(Disconnecting)
-		err = ibbq.client.CancelConnection()
-		if ibbq.device != nil && force {
-			ibbq.client = nil
-			ibbq.profile = nil
-			err = ibbq.device.Stop()
-			ibbq.updateStatus(Disconnected)
-			go ibbq.disconnectedHandler()
+		err = s.client.CancelConnection()
+		if force {
+			err = ibbq.endSession(s)
 		}
 	}
 	return err
 }
 
-func filter() ble.AdvFilter {
+func filter(address string) ble.AdvFilter {
 	return func(a ble.Advertisement) bool {
+		if address != "" && !strings.EqualFold(a.Addr().String(), address) {
+			return false
+		}
 		return strings.ToLower(a.LocalName()) == strings.ToLower(DeviceName) && a.Connectable()
 	}
 }
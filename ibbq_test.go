@@ -0,0 +1,77 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestTenths(t *testing.T) {
+	tests := []struct {
+		temperature float64
+		want        int16
+	}{
+		{0, 0},
+		{21.54, 215},
+		{21.55, 216},
+		{-40, -400},
+		{3276.7, math.MaxInt16},
+		{5000, math.MaxInt16},
+		{math.Inf(1), math.MaxInt16},
+		{-3276.8, math.MinInt16},
+		{-5000, math.MinInt16},
+		{math.Inf(-1), math.MinInt16},
+	}
+	for _, test := range tests {
+		if got := tenths(test.temperature); got != test.want {
+			t.Errorf("tenths(%v) = %d, want %d", test.temperature, got, test.want)
+		}
+	}
+}
+
+func TestSetProbeAlarm(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(bbq *Ibbq) error
+		want    []byte
+		wantErr bool
+	}{
+		{"range", func(bbq *Ibbq) error { return bbq.SetProbeAlarm(1, 50, 80.5) }, []byte{0x01, 0x01, 0xf4, 0x01, 0x25, 0x03}, false},
+		{"below freezing", func(bbq *Ibbq) error { return bbq.SetProbeAlarm(0, -10, 4) }, []byte{0x01, 0x00, 0x9c, 0xff, 0x28, 0x00}, false},
+		{"clamped", func(bbq *Ibbq) error { return bbq.SetProbeAlarm(2, math.Inf(-1), 5000) }, []byte{0x01, 0x02, 0x00, 0x80, 0xff, 0x7f}, false},
+		{"high only", func(bbq *Ibbq) error { return bbq.SetProbeHighAlarm(3, 95) }, []byte{0x01, 0x03, 0x00, 0x80, 0xb6, 0x03}, false},
+		{"low above high", func(bbq *Ibbq) error { return bbq.SetProbeAlarm(0, 80, 50) }, nil, true},
+		{"invalid probe", func(bbq *Ibbq) error { return bbq.SetProbeHighAlarm(-1, 95) }, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &fakeDevice{}
+			bbq, _ := newTestIbbq(t, context.Background(), d, SerialDispatch)
+			defer bbq.Close()
+			if err := bbq.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			if err := test.set(bbq); (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if test.want != nil && !d.client().wrote(test.want) {
+				t.Errorf("setting % x wasn't written", test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package lid detects the cooker's lid being opened, from the characteristic sharp drop and
+// recovery of the ambient (pit) probe's temperature.
+package lid
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+// CookerType names a kind of cooker, each of which reacts differently to its lid being opened.
+type CookerType string
+
+const (
+	// Kettle is a kettle grill.
+	Kettle CookerType = "kettle"
+	// Kamado is a ceramic kamado-style cooker.
+	Kamado CookerType = "kamado"
+	// Offset is an offset smoker.
+	Offset CookerType = "offset"
+	// Pellet is a fan-controlled pellet grill.
+	Pellet CookerType = "pellet"
+	// Electric is an electric smoker.
+	Electric CookerType = "electric"
+)
+
+// Configuration configures a Detector.
+type Configuration struct {
+	// AmbientProbe is the index of the probe measuring the cooker's temperature.
+	AmbientProbe int
+	// MinDrop is the fall in temperature, in celsius, which signals the lid has been opened.
+	MinDrop float64
+	// DropWindow is the period within which the temperature must fall by MinDrop.
+	DropWindow time.Duration
+	// MinRise is the rise in temperature, in celsius, from its lowest point which signals the lid has been closed.
+	MinRise float64
+	// RecoveryFraction is the fraction of the drop which must be recovered before readings are trusted again.
+	RecoveryFraction float64
+	// MaxOpen is the longest the lid is assumed to stay open, after which readings are trusted again regardless.
+	MaxOpen time.Duration
+}
+
+// DefaultConfiguration is a somewhat sane default, which suits most kettle grills.
+var DefaultConfiguration = ConfigurationFor(Kettle)
+
+// ConfigurationFor returns a configuration suited to a kind of cooker. Unknown cooker types get the default.
+func ConfigurationFor(cooker CookerType) Configuration {
+	config := Configuration{
+		MinDrop:          12,
+		DropWindow:       time.Minute,
+		MinRise:          3,
+		RecoveryFraction: 0.8,
+		MaxOpen:          15 * time.Minute,
+	}
+	switch cooker {
+	case Kamado:
+		// ceramic holds its heat, but the rush of air flares the coals; the drop is sharp and short-lived
+		config.MinDrop = 15
+		config.RecoveryFraction = 0.9
+	case Offset:
+		// a big cooking chamber loses a lot of heat, and takes a while to get it back
+		config.MinDrop = 20
+		config.DropWindow = 2 * time.Minute
+		config.MaxOpen = 20 * time.Minute
+	case Pellet:
+		// the controller fights back quickly
+		config.MinDrop = 10
+		config.MinRise = 2
+		config.RecoveryFraction = 0.9
+		config.MaxOpen = 10 * time.Minute
+	case Electric:
+		// small drops, and slow recovery
+		config.MinDrop = 8
+		config.DropWindow = 2 * time.Minute
+		config.MinRise = 2
+		config.MaxOpen = 20 * time.Minute
+	}
+	return config
+}
+
+// EventType distinguishes the lid being opened from it being closed.
+type EventType string
+
+const (
+	// LidOpened means the lid has been opened.
+	LidOpened EventType = "LidOpened"
+	// LidClosed means the lid has been closed, or the ambient probe has been unplugged while it was open.
+	LidClosed EventType = "LidClosed"
+)
+
+// Event reports the lid being opened or closed.
+type Event struct {
+	Type EventType
+	// Time is when the lid was opened or closed.
+	Time time.Time
+	// Temperature is the ambient probe's temperature when the event was detected, in celsius.
+	// It is ibbq.UnpluggedTemperature when the lid is taken to be closed because the probe was unplugged.
+	Temperature float64
+	// Drop is how far the temperature has fallen since the lid was opened, in celsius.
+	Drop float64
+	// Duration is how long the lid was open. It is only set when the lid is closed.
+	Duration time.Duration
+}
+
+// Handler is a callback for lid events.
+type Handler func(Event)
+
+type sample struct {
+	time        time.Time
+	temperature float64
+}
+
+// Detector detects the lid being opened and closed. It is safe for concurrent use.
+//
+// Readings are suppressed from the moment the lid is opened until the cooker has recovered,
+// so a Detector can be given to other consumers as an ibbq.Suppressor.
+type Detector struct {
+	mu         sync.Mutex
+	config     Configuration
+	handler    Handler
+	samples    []sample
+	open       bool
+	recovering bool
+	openedAt   time.Time
+	baseline   float64
+	trough     sample
+}
+
+// NewDetector creates a detector. The handler, which may be nil, is called with each lid event.
+func NewDetector(config Configuration, handler Handler) *Detector {
+	return &Detector{
+		config:  config,
+		handler: handler,
+	}
+}
+
+// Update feeds a reading to the detector. It is meant to be called from a reading handler.
+func (d *Detector) Update(reading ibbq.Reading) {
+	d.mu.Lock()
+	event, ok := d.update(reading)
+	handler := d.handler
+	d.mu.Unlock()
+	if ok && handler != nil {
+		handler(event)
+	}
+}
+
+// Open reports whether the lid is open.
+func (d *Detector) Open() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.open
+}
+
+// Suppressed reports whether readings should be discounted: the lid is open, or the cooker hasn't yet recovered.
+func (d *Detector) Suppressed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.open || d.recovering
+}
+
+func (d *Detector) update(reading ibbq.Reading) (Event, bool) {
+	probe := d.config.AmbientProbe
+	if probe < 0 || probe >= len(reading.Temperatures) || !ibbq.ProbeConnected(reading.Temperatures[probe]) {
+		// without the probe the lid can't be seen closing, so it is taken to be closed, and suppression ends
+		wasOpen := d.open
+		d.samples = nil
+		d.open = false
+		d.recovering = false
+		if !wasOpen {
+			return Event{}, false
+		}
+		return Event{
+			Type:        LidClosed,
+			Time:        reading.Time,
+			Temperature: ibbq.UnpluggedTemperature,
+			Drop:        d.baseline - d.trough.temperature,
+			Duration:    reading.Time.Sub(d.openedAt),
+		}, true
+	}
+	current := sample{reading.Time, reading.Temperatures[probe]}
+	d.samples = append(d.samples, current)
+	start := 0
+	for start < len(d.samples) && current.time.Sub(d.samples[start].time) > d.config.DropWindow {
+		start++
+	}
+	d.samples = append(d.samples[:0], d.samples[start:]...)
+
+	switch {
+	case d.open:
+		if current.temperature < d.trough.temperature {
+			d.trough = current
+		}
+		if current.temperature-d.trough.temperature >= d.config.MinRise || current.time.Sub(d.openedAt) >= d.config.MaxOpen {
+			d.open = false
+			d.recovering = true
+			return Event{
+				Type:        LidClosed,
+				Time:        d.trough.time,
+				Temperature: current.temperature,
+				Drop:        d.baseline - d.trough.temperature,
+				Duration:    d.trough.time.Sub(d.openedAt),
+			}, true
+		}
+	case d.recovering:
+		recovered := d.baseline - (1-d.config.RecoveryFraction)*(d.baseline-d.trough.temperature)
+		if current.temperature >= recovered || current.time.Sub(d.openedAt) >= d.config.MaxOpen {
+			d.recovering = false
+			d.samples = []sample{current}
+		}
+	default:
+		peak := d.samples[0]
+		for _, s := range d.samples {
+			if s.temperature > peak.temperature {
+				peak = s
+			}
+		}
+		if peak.temperature-current.temperature >= d.config.MinDrop {
+			d.open = true
+			d.openedAt = peak.time
+			d.baseline = peak.temperature
+			d.trough = current
+			return Event{
+				Type:        LidOpened,
+				Time:        peak.time,
+				Temperature: current.temperature,
+				Drop:        peak.temperature - current.temperature,
+			}, true
+		}
+	}
+	return Event{}, false
+}
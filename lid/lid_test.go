@@ -0,0 +1,141 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package lid
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+const unplugged = ibbq.UnpluggedTemperature
+
+var start = time.Unix(1600000000, 0)
+
+// at returns the time of the nth reading, as readings are ten seconds apart.
+func at(n int) time.Time {
+	return start.Add(time.Duration(n) * 10 * time.Second)
+}
+
+func TestDetector(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(c *Configuration)
+		// temperatures are the ambient probe's temperatures, ten seconds apart
+		temperatures []float64
+		want         []Event
+		// suppressed has an 'S' for each reading after which readings are suppressed
+		suppressed string
+	}{
+		{"opened and closed", func(c *Configuration) {},
+			[]float64{118, 119, 120, 100, 95, 97, 99, 110, 116, 117},
+			[]Event{
+				{Type: LidOpened, Time: at(2), Temperature: 100, Drop: 20},
+				{Type: LidClosed, Time: at(4), Temperature: 99, Drop: 25, Duration: 20 * time.Second},
+			},
+			"...SSSSS.."},
+		{"slow fall", func(c *Configuration) {},
+			[]float64{120, 119, 118, 117, 116, 115, 114, 113, 112, 111, 110, 109, 108},
+			nil,
+			"............."},
+		{"drop outside the window", func(c *Configuration) { c.DropWindow = 20 * time.Second },
+			[]float64{120, 115, 110, 105, 100},
+			nil,
+			"....."},
+		{"open for too long", func(c *Configuration) { c.MaxOpen = time.Minute },
+			[]float64{120, 100, 100, 100, 100, 100, 100, 100, 100},
+			[]Event{
+				{Type: LidOpened, Time: at(0), Temperature: 100, Drop: 20},
+				{Type: LidClosed, Time: at(1), Temperature: 100, Drop: 20, Duration: 10 * time.Second},
+			},
+			".SSSSSS.."},
+		{"unplugged while open", func(c *Configuration) {},
+			[]float64{120, 100, unplugged, 100, 100},
+			[]Event{
+				{Type: LidOpened, Time: at(0), Temperature: 100, Drop: 20},
+				{Type: LidClosed, Time: at(2), Temperature: unplugged, Drop: 20, Duration: 20 * time.Second},
+			},
+			".S..."},
+		{"unplugged while recovering", func(c *Configuration) {},
+			[]float64{120, 100, 95, 99, unplugged, 100},
+			[]Event{
+				{Type: LidOpened, Time: at(0), Temperature: 100, Drop: 20},
+				{Type: LidClosed, Time: at(2), Temperature: 99, Drop: 25, Duration: 20 * time.Second},
+			},
+			".SSS.."},
+		{"other probe", func(c *Configuration) { c.AmbientProbe = 2 },
+			[]float64{120, 100, 95, 99},
+			nil,
+			"...."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfiguration
+			test.config(&config)
+			var got []Event
+			d := NewDetector(config, func(e Event) { got = append(got, e) })
+			suppressed := ""
+			for i, temperature := range test.temperatures {
+				d.Update(ibbq.Reading{Time: at(i), Temperatures: []float64{temperature, 50}})
+				if d.Suppressed() {
+					suppressed += "S"
+				} else {
+					suppressed += "."
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got events %+v, want %+v", got, test.want)
+			}
+			if suppressed != test.suppressed {
+				t.Errorf("got suppressed %q, want %q", suppressed, test.suppressed)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	d := NewDetector(DefaultConfiguration, nil)
+	for i, temperature := range []float64{120, 100, 95} {
+		d.Update(ibbq.Reading{Time: at(i), Temperatures: []float64{temperature}})
+	}
+	if !d.Open() {
+		t.Error("lid isn't open after the temperature dropped")
+	}
+	d.Update(ibbq.Reading{Time: at(3), Temperatures: []float64{99}})
+	if d.Open() || !d.Suppressed() {
+		t.Error("lid isn't closed and recovering after the temperature rose")
+	}
+}
+
+func TestConfigurationFor(t *testing.T) {
+	if got := ConfigurationFor("unknown"); got != ConfigurationFor(Kettle) {
+		t.Errorf("got %+v for an unknown cooker, want the kettle configuration", got)
+	}
+	for _, cooker := range []CookerType{Kamado, Offset, Pellet, Electric} {
+		t.Run(string(cooker), func(t *testing.T) {
+			config := ConfigurationFor(cooker)
+			if config == DefaultConfiguration {
+				t.Error("got the default configuration")
+			}
+			if config.MinDrop <= 0 || config.DropWindow <= 0 || config.MinRise <= 0 || config.MaxOpen <= 0 ||
+				config.RecoveryFraction <= 0 || config.RecoveryFraction > 1 {
+				t.Errorf("got unusable configuration %+v", config)
+			}
+		})
+	}
+}
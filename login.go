@@ -0,0 +1,85 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+
+	"github.com/go-ble/ble"
+)
+
+// ErrLoginRejected is returned when the device acknowledges a login with an unexpected value.
+var ErrLoginRejected = errors.New("login acknowledgement did not match")
+
+// LoginStrategy performs the login handshake with a device after its profile has been discovered.
+// Vendor variants with a different handshake can be supported by providing their own implementation.
+type LoginStrategy interface {
+	Login(client ble.Client, profile *ble.Profile) error
+}
+
+// CredentialsLogin logs in by writing fixed credentials to the AccountAndVerify characteristic.
+type CredentialsLogin struct {
+	// Credentials are written verbatim to the AccountAndVerify characteristic.
+	Credentials []byte
+	// Acknowledgement, if set, is compared against the value read back from the
+	// AccountAndVerify characteristic once the credentials have been written.
+	// It is only checked when the device allows the characteristic to be read.
+	Acknowledgement []byte
+}
+
+// NewCredentialsLogin creates a login strategy which writes the given credentials.
+func NewCredentialsLogin(credentials []byte) *CredentialsLogin {
+	return &CredentialsLogin{Credentials: append([]byte(nil), credentials...)}
+}
+
+// DefaultCredentials returns a copy of the credentials used by stock iBBQ devices.
+func DefaultCredentials() []byte {
+	return append([]byte(nil), defaultCredentials...)
+}
+
+// Login writes the credentials and validates the acknowledgement, if any.
+func (l *CredentialsLogin) Login(client ble.Client, profile *ble.Profile) error {
+	var err error
+	var uuid ble.UUID
+	if uuid, err = ble.Parse(AccountAndVerify); err != nil {
+		return err
+	}
+	logger.Debug("logging in to device", "addr", client.Addr(), "uuid", uuid)
+	c := profile.FindCharacteristic(ble.NewCharacteristic(uuid))
+	if c == nil {
+		logger.Debug("device has no characteristic for login, skipping")
+		return nil
+	}
+	if err = client.WriteCharacteristic(c, l.Credentials, false); err != nil {
+		return err
+	}
+	logger.Debug("credentials written")
+	if len(l.Acknowledgement) == 0 || c.Property&ble.CharRead == 0 {
+		return nil
+	}
+	var ack []byte
+	if ack, err = client.ReadCharacteristic(c); err != nil {
+		return err
+	}
+	if !bytes.Equal(ack, l.Acknowledgement) {
+		logger.Error("Unexpected login acknowledgement", "ack", hex.EncodeToString(ack))
+		return ErrLoginRejected
+	}
+	logger.Debug("login acknowledged")
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-ble/ble"
+)
+
+// loginProfile returns a profile with the AccountAndVerify characteristic, which has the given properties.
+func loginProfile(property ble.Property) *ble.Profile {
+	c := &ble.Characteristic{UUID: ble.MustParse(AccountAndVerify), Property: property}
+	return &ble.Profile{Services: []*ble.Service{{UUID: ble.MustParse("fff0"), Characteristics: []*ble.Characteristic{c}}}}
+}
+
+func TestCredentialsLogin(t *testing.T) {
+	credentials := []byte{0x01, 0x02, 0x03}
+	tests := []struct {
+		name      string
+		ack       []byte
+		profile   *ble.Profile
+		wantErr   error
+		wantWrite bool
+		wantReads int
+	}{
+		{"ack matches", []byte{0xaa}, loginProfile(ble.CharWrite | ble.CharRead), nil, true, 1},
+		{"ack mismatches", []byte{0xbb}, loginProfile(ble.CharWrite | ble.CharRead), ErrLoginRejected, true, 1},
+		{"characteristic isn't readable", []byte{0xbb}, loginProfile(ble.CharWrite), nil, true, 0},
+		{"no characteristic", []byte{0xbb}, &ble.Profile{}, nil, false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeClient{ack: test.ack, disconnected: make(chan struct{})}
+			login := NewCredentialsLogin(credentials)
+			login.Acknowledgement = []byte{0xaa}
+			if err := login.Login(client, test.profile); err != test.wantErr {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			if client.wrote(credentials) != test.wantWrite {
+				t.Errorf("got credentials written %v, want %v", client.wrote(credentials), test.wantWrite)
+			}
+			if client.reads != test.wantReads {
+				t.Errorf("got %d reads, want %d", client.reads, test.wantReads)
+			}
+		})
+	}
+}
+
+func TestCredentialsLoginWithoutAcknowledgement(t *testing.T) {
+	client := &fakeClient{ack: []byte{0xbb}, disconnected: make(chan struct{})}
+	if err := NewCredentialsLogin(DefaultCredentials()).Login(client, loginProfile(ble.CharWrite|ble.CharRead)); err != nil {
+		t.Fatal(err)
+	}
+	if !client.wrote(DefaultCredentials()) || client.reads != 0 {
+		t.Errorf("got credentials written %v and %d reads, want the default credentials written without reading",
+			client.wrote(DefaultCredentials()), client.reads)
+	}
+}
+
+// loginFunc adapts a function to the LoginStrategy interface.
+type loginFunc func(client ble.Client, profile *ble.Profile) error
+
+func (f loginFunc) Login(client ble.Client, profile *ble.Profile) error { return f(client, profile) }
+
+func TestLoginStrategy(t *testing.T) {
+	rejected := errors.New("rejected")
+	tests := []struct {
+		name     string
+		strategy LoginStrategy
+		wantErr  error
+		// wantWrite is the login written to the device, if any
+		wantWrite []byte
+	}{
+		{"default", nil, nil, DefaultCredentials()},
+		{"credentials", NewCredentialsLogin([]byte{0x01, 0x02}), nil, []byte{0x01, 0x02}},
+		{"custom", loginFunc(func(ble.Client, *ble.Profile) error { return nil }), nil, nil},
+		{"custom rejected", loginFunc(func(ble.Client, *ble.Profile) error { return rejected }), rejected, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &fakeDevice{}
+			bbq, _ := newTestIbbq(t, context.Background(), d, SerialDispatch)
+			defer bbq.Close()
+			called := false
+			if test.strategy != nil {
+				strategy := test.strategy
+				bbq.config.LoginStrategy = loginFunc(func(client ble.Client, profile *ble.Profile) error {
+					called = true
+					return strategy.Login(client, profile)
+				})
+			}
+			if err := bbq.Connect(); err != test.wantErr {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if test.strategy != nil && !called {
+				t.Error("login strategy wasn't used")
+			}
+			if test.wantWrite != nil && !d.client().wrote(test.wantWrite) {
+				t.Errorf("%x wasn't written", test.wantWrite)
+			}
+			if test.wantWrite == nil && d.client().wrote(DefaultCredentials()) {
+				t.Error("default credentials were written")
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package notify delivers alert events to webhooks, push services, chat and email,
+// with retries and rate limiting.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mgutz/logxi/v1"
+	"github.com/sworisbreathing/go-ibbq/v2/alert"
+)
+
+var logger = log.New("notify")
+
+// Message is a notification about an alert event.
+type Message struct {
+	// Title is a one-line summary, e.g. "Alert fired: brisket done".
+	Title string
+	// Text describes the alert in a sentence.
+	Text string
+	// Urgent is set for alerts which have fired or are being re-notified, and unset for resolved alerts.
+	Urgent bool
+	// Time is when the event occurred.
+	Time time.Time
+	// Event is the alert event being notified.
+	Event alert.Event
+}
+
+// MessageFor describes an alert event.
+func MessageFor(event alert.Event) Message {
+	rule := event.Alert.Rule
+	var title string
+	switch event.Type {
+	case alert.Fired:
+		title = "Alert fired: " + rule.Name
+	case alert.Renotified:
+		title = "Alert still active: " + rule.Name
+	default:
+		title = "Alert resolved: " + rule.Name
+	}
+	return Message{
+		Title:  title,
+		Text:   describe(event),
+		Urgent: event.Type != alert.Resolved,
+		Time:   event.Time,
+		Event:  event,
+	}
+}
+
+func describe(event alert.Event) string {
+	rule, value := event.Alert.Rule, event.Alert.Value
+	probe := rule.Probe + 1
+	resolved := event.Type == alert.Resolved
+	switch rule.Kind {
+	case alert.Above:
+		if resolved {
+			return fmt.Sprintf("Probe %d is back below %.1f°C, at %.1f°C", probe, rule.Threshold, value)
+		}
+		return fmt.Sprintf("Probe %d is above %.1f°C, at %.1f°C", probe, rule.Threshold, value)
+	case alert.Below:
+		if resolved {
+			return fmt.Sprintf("Probe %d is back above %.1f°C, at %.1f°C", probe, rule.Threshold, value)
+		}
+		return fmt.Sprintf("Probe %d is below %.1f°C, at %.1f°C", probe, rule.Threshold, value)
+	case alert.Outside:
+		if resolved {
+			return fmt.Sprintf("Probe %d is back within %.1f–%.1f°C, at %.1f°C", probe, rule.Low, rule.High, value)
+		}
+		return fmt.Sprintf("Probe %d is outside %.1f–%.1f°C, at %.1f°C", probe, rule.Low, rule.High, value)
+	case alert.Rising, alert.Falling:
+		if resolved {
+			return fmt.Sprintf("Probe %d is changing at %.1f°C/min again", probe, value)
+		}
+		return fmt.Sprintf("Probe %d is %s at %.1f°C/min", probe, rule.Kind, value)
+	case alert.Stale:
+		if resolved {
+			return "Readings are being received again"
+		}
+		return fmt.Sprintf("No readings received for %s", (time.Duration(value) * time.Second).String())
+	case alert.BatteryLow:
+		if resolved {
+			return fmt.Sprintf("Battery is back at %.0f%%", value)
+		}
+		return fmt.Sprintf("Battery is low, at %.0f%%", value)
+	case alert.Unplugged:
+		if resolved {
+			return fmt.Sprintf("Probe %d has been plugged back in", probe)
+		}
+		return fmt.Sprintf("Probe %d has been unplugged", probe)
+	}
+	return rule.Name
+}
+
+// Sink delivers messages to a destination.
+type Sink interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, message Message) error
+
+// Send calls the function.
+func (f SinkFunc) Send(ctx context.Context, message Message) error {
+	return f(ctx, message)
+}
+
+// Configuration configures a Notifier.
+type Configuration struct {
+	// Timeout limits each delivery attempt.
+	Timeout time.Duration
+	// Retries is how many times a failed delivery is retried.
+	Retries int
+	// RetryDelay is the delay before the first retry, doubling for each retry after it.
+	RetryDelay time.Duration
+	// MinInterval is the least time between messages to any one sink. Messages are queued until it has passed.
+	MinInterval time.Duration
+	// QueueSize is how many messages may be queued for each sink before further messages are dropped.
+	QueueSize int
+	// Resolved selects whether resolved alerts are notified as well as fired ones.
+	Resolved bool
+}
+
+// DefaultConfiguration is a somewhat sane default.
+var DefaultConfiguration = Configuration{
+	Timeout:     10 * time.Second,
+	Retries:     3,
+	RetryDelay:  2 * time.Second,
+	MinInterval: time.Second,
+	QueueSize:   32,
+	Resolved:    true,
+}
+
+// ErrorHandler is a callback for messages which could not be delivered.
+type ErrorHandler func(sink Sink, message Message, err error)
+
+// Notifier delivers alert events to its sinks. Each sink has its own queue, so a slow sink does not hold up the others.
+type Notifier struct {
+	config       Configuration
+	mu           sync.Mutex
+	errorHandler ErrorHandler
+	queues       []chan Message
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	closeOnce    sync.Once
+}
+
+// NewNotifier creates a notifier delivering to the given sinks, until it is closed.
+// Unset queue sizes and timeouts are taken from DefaultConfiguration.
+func NewNotifier(config Configuration, sinks ...Sink) *Notifier {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultConfiguration.QueueSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfiguration.Timeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{config: config, ctx: ctx, cancel: cancel}
+	for _, sink := range sinks {
+		queue := make(chan Message, config.QueueSize)
+		n.queues = append(n.queues, queue)
+		n.wg.Add(1)
+		go n.deliver(sink, queue)
+	}
+	return n
+}
+
+// SetErrorHandler sets the handler for messages which could not be delivered, after all retries.
+func (n *Notifier) SetErrorHandler(errorHandler ErrorHandler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.errorHandler = errorHandler
+}
+
+// Notify queues an alert event for delivery. It has the signature of an alert.Handler, so a notifier can
+// be given directly to alert.NewEngine.
+func (n *Notifier) Notify(event alert.Event) {
+	if event.Type == alert.Resolved && !n.config.Resolved {
+		return
+	}
+	n.Send(MessageFor(event))
+}
+
+// Send queues a message for delivery to every sink, dropping it for any sink whose queue is full.
+func (n *Notifier) Send(message Message) {
+	select {
+	case <-n.ctx.Done():
+		return
+	default:
+	}
+	for _, queue := range n.queues {
+		select {
+		case queue <- message:
+		default:
+			logger.Warn("Notification queue full, dropping message", "title", message.Title)
+		}
+	}
+}
+
+// Close stops delivery, abandoning any queued messages, and waits for in-flight deliveries to finish.
+func (n *Notifier) Close() {
+	n.closeOnce.Do(n.cancel)
+	n.wg.Wait()
+}
+
+func (n *Notifier) deliver(sink Sink, queue chan Message) {
+	defer n.wg.Done()
+	var last time.Time
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case message := <-queue:
+			if wait := n.config.MinInterval - time.Since(last); !last.IsZero() && wait > 0 {
+				if !sleep(n.ctx, wait) {
+					return
+				}
+			}
+			last = time.Now()
+			if err := n.sendWithRetries(sink, message); err != nil {
+				logger.Warn("Failed to deliver notification", "title", message.Title, "err", err)
+				n.mu.Lock()
+				errorHandler := n.errorHandler
+				n.mu.Unlock()
+				if errorHandler != nil {
+					errorHandler(sink, message, err)
+				}
+			}
+		}
+	}
+}
+
+func (n *Notifier) sendWithRetries(sink Sink, message Message) error {
+	delay := n.config.RetryDelay
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = n.send(sink, message); err == nil {
+			return nil
+		}
+		if attempt >= n.config.Retries {
+			return err
+		}
+		logger.Debug("Retrying notification", "title", message.Title, "attempt", attempt+1, "err", err)
+		if !sleep(n.ctx, delay) {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+func (n *Notifier) send(sink Sink, message Message) error {
+	ctx, cancel := context.WithTimeout(n.ctx, n.config.Timeout)
+	defer cancel()
+	return sink.Send(ctx, message)
+}
+
+// sleep waits for the duration, reporting false if the context is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
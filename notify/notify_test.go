@@ -0,0 +1,81 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifierDefaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Configuration
+		want   Configuration
+	}{
+		{"zero", Configuration{}, Configuration{QueueSize: DefaultConfiguration.QueueSize, Timeout: DefaultConfiguration.Timeout}},
+		{"negative", Configuration{QueueSize: -1, Timeout: -time.Second}, Configuration{QueueSize: DefaultConfiguration.QueueSize, Timeout: DefaultConfiguration.Timeout}},
+		{"set", Configuration{QueueSize: 5, Timeout: time.Second, Retries: 1}, Configuration{QueueSize: 5, Timeout: time.Second, Retries: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := NewNotifier(test.config)
+			defer n.Close()
+			if n.config != test.want {
+				t.Errorf("got %+v, want %+v", n.config, test.want)
+			}
+		})
+	}
+}
+
+func TestZeroConfigurationDelivers(t *testing.T) {
+	const messages = 10
+	var mu sync.Mutex
+	var got []string
+	delivered := make(chan struct{})
+	sink := SinkFunc(func(ctx context.Context, message Message) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("delivery has no timeout")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, message.Title)
+		if len(got) == messages {
+			close(delivered)
+		}
+		return nil
+	})
+	n := NewNotifier(Configuration{}, sink)
+	defer n.Close()
+	for i := 0; i < messages; i++ {
+		n.Send(Message{Title: fmt.Sprint(i)})
+	}
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		mu.Lock()
+		defer mu.Unlock()
+		t.Fatalf("got %d of %d messages", len(got), messages)
+	}
+	for i, title := range got {
+		if title != fmt.Sprint(i) {
+			t.Errorf("got message %q at position %d", title, i)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// DefaultNtfyServer is the public ntfy server.
+const DefaultNtfyServer = "https://ntfy.sh"
+
+// Ntfy publishes messages as push notifications to an ntfy-style topic.
+type Ntfy struct {
+	// Server is the ntfy server's base URL.
+	Server string
+	// Topic is the topic to publish to.
+	Topic string
+	// Token, if set, is sent as a bearer token for servers requiring authentication.
+	Token string
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewNtfy creates a sink publishing to a topic on the public ntfy server.
+func NewNtfy(topic string) *Ntfy {
+	return &Ntfy{Server: DefaultNtfyServer, Topic: topic}
+}
+
+// Send publishes the message. Urgent messages are sent with high priority.
+func (n *Ntfy) Send(ctx context.Context, message Message) error {
+	header := http.Header{}
+	header.Set("Title", message.Title)
+	if message.Urgent {
+		header.Set("Priority", "high")
+		header.Set("Tags", "rotating_light")
+	} else {
+		header.Set("Priority", "default")
+		header.Set("Tags", "white_check_mark")
+	}
+	if n.Token != "" {
+		header.Set("Authorization", "Bearer "+n.Token)
+	}
+	url := strings.TrimRight(n.Server, "/") + "/" + n.Topic
+	return post(ctx, n.Client, url, header, "text/plain; charset=utf-8", strings.NewReader(message.Text))
+}
@@ -0,0 +1,69 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package notify
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sworisbreathing/go-ibbq/v2/alert"
+)
+
+func TestNtfy(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    alert.EventType
+		token    string
+		priority string
+		tags     string
+		auth     string
+	}{
+		{"fired", alert.Fired, "", "high", "rotating_light", ""},
+		{"resolved", alert.Resolved, "", "default", "white_check_mark", ""},
+		{"token", alert.Fired, "tk_secret", "high", "rotating_light", "Bearer tk_secret"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := newServer(t, http.StatusOK)
+			defer server.Close()
+			ntfy := NewNtfy("smoker")
+			ntfy.Server = server.URL + "/"
+			ntfy.Token = test.token
+			message := testMessage(test.event)
+			if err := ntfy.Send(context.Background(), message); err != nil {
+				t.Fatal(err)
+			}
+			r := <-requests
+			if r.path != "/smoker" {
+				t.Errorf("got path %q, want /smoker", r.path)
+			}
+			if r.body != message.Text {
+				t.Errorf("got body %q, want %q", r.body, message.Text)
+			}
+			for header, want := range map[string]string{
+				"Title":         message.Title,
+				"Priority":      test.priority,
+				"Tags":          test.tags,
+				"Authorization": test.auth,
+			} {
+				if got := r.header.Get(header); got != want {
+					t.Errorf("got %s %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
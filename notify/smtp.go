@@ -0,0 +1,122 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Email sends messages by SMTP.
+type Email struct {
+	// Addr is the SMTP server's address, as host:port.
+	Addr string
+	// Auth, if set, authenticates with the server, e.g. smtp.PlainAuth.
+	Auth smtp.Auth
+	// From is the sender's address.
+	From string
+	// To are the recipients' addresses.
+	To []string
+	// TLSConfig, if set, is used for STARTTLS. Otherwise the server's certificate is verified against its host name.
+	TLSConfig *tls.Config
+}
+
+// NewEmail creates a sink sending email through the given server. If username is not empty,
+// it authenticates with PLAIN auth, which the server only accepts over TLS or on localhost.
+func NewEmail(addr, username, password, from string, to ...string) *Email {
+	email := &Email{Addr: addr, From: from, To: to}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		email.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return email
+}
+
+// Send emails the message. net/smtp cannot be cancelled, so the context only bounds connecting to the server.
+func (e *Email) Send(ctx context.Context, message Message) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	host, _, _ := net.SplitHostPort(e.Addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		config := e.TLSConfig
+		if config == nil {
+			config = &tls.Config{ServerName: host}
+		}
+		if err = client.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if e.Auth != nil {
+		if err = client.Auth(e.Auth); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(e.format(message)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (e *Email) format(message Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", message.Time.Format(time.RFC1123Z))
+	if message.Urgent {
+		b.WriteString("X-Priority: 1\r\n")
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(message.Text)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,178 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2/alert"
+)
+
+// smtpSession is what an SMTP stand-in received.
+type smtpSession struct {
+	tls  bool
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// testCertificate borrows httptest's certificate for 127.0.0.1, returning it and a pool trusting it.
+func testCertificate() (tls.Certificate, *x509.CertPool) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return server.TLS.Certificates[0], pool
+}
+
+// serveSMTP runs a minimal SMTP server for one session, offering STARTTLS, and AUTH PLAIN once TLS is established.
+func serveSMTP(t *testing.T, listener net.Listener, cert tls.Certificate, sessions chan<- smtpSession) {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Errorf("accepting: %v", err)
+		close(sessions)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	var session smtpSession
+	defer func() { sessions <- session }()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case verb == "EHLO" && session.tls:
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 AUTH PLAIN")
+		case verb == "EHLO":
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 STARTTLS")
+		case verb == "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			session.tls = true
+			text = textproto.NewConn(tlsConn)
+		case verb == "AUTH":
+			decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			session.auth = string(decoded)
+			text.PrintfLine("235 ok")
+		case verb == "MAIL":
+			session.from = line
+			text.PrintfLine("250 ok")
+		case verb == "RCPT":
+			session.to = append(session.to, line)
+			text.PrintfLine("250 ok")
+		case verb == "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			session.data = string(data)
+			text.PrintfLine("250 ok")
+		case verb == "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// startSMTP starts an SMTP stand-in for one session, returning its address, a pool trusting its certificate,
+// and a channel receiving the session once it ends.
+func startSMTP(t *testing.T) (string, *x509.CertPool, <-chan smtpSession) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, pool := testCertificate()
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		defer listener.Close()
+		serveSMTP(t, listener, cert, sessions)
+	}()
+	return listener.Addr().String(), pool, sessions
+}
+
+func TestEmail(t *testing.T) {
+	addr, pool, sessions := startSMTP(t)
+	email := NewEmail(addr, "pitmaster", "secret", "bbq@example.com", "me@example.com", "you@example.com")
+	email.TLSConfig = &tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := email.Send(ctx, testMessage(alert.Fired)); err != nil {
+		t.Fatal(err)
+	}
+	session := <-sessions
+	if !session.tls {
+		t.Error("STARTTLS wasn't used")
+	}
+	if want := "\x00pitmaster\x00secret"; session.auth != want {
+		t.Errorf("got auth %q, want %q", session.auth, want)
+	}
+	if want := "MAIL FROM:<bbq@example.com>"; !strings.HasPrefix(session.from, want) {
+		t.Errorf("got %q, want %q", session.from, want)
+	}
+	if len(session.to) != 2 || !strings.Contains(session.to[1], "<you@example.com>") {
+		t.Errorf("got recipients %q", session.to)
+	}
+	for _, want := range []string{
+		"From: bbq@example.com\n",
+		"To: me@example.com, you@example.com\n",
+		"Subject: Alert fired: brisket done\n",
+		"X-Priority: 1\n",
+		"\nProbe 2 is above 93.0°C, at 93.5°C\n",
+	} {
+		if !strings.Contains(session.data, want) {
+			t.Errorf("message %q doesn't contain %q", session.data, want)
+		}
+	}
+}
+
+func TestEmailVerifiesServerCertificate(t *testing.T) {
+	addr, _, sessions := startSMTP(t)
+	email := NewEmail(addr, "pitmaster", "secret", "bbq@example.com", "me@example.com")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := email.Send(ctx, testMessage(alert.Fired))
+	// the default config names the server, so the handshake gets as far as rejecting the untrusted certificate
+	if err == nil || strings.Contains(err.Error(), "ServerName") {
+		t.Errorf("got error %v, want the certificate to be rejected", err)
+	}
+	if session := <-sessions; session.auth != "" {
+		t.Error("credentials were sent without a verified TLS connection")
+	}
+}
@@ -0,0 +1,178 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// HTTPError reports a delivery rejected by an HTTP server.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("server responded with %d: %s", e.StatusCode, e.Body)
+}
+
+// Webhook posts messages as JSON to a URL.
+type Webhook struct {
+	// URL is where messages are posted.
+	URL string
+	// Header holds extra request headers, e.g. for authorization.
+	Header http.Header
+	// Template, if set, renders the request body from the Message. Otherwise the body is
+	// a JSON object with the message's title, text, urgency, time, rule, event and value.
+	Template *template.Template
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewWebhook creates a webhook sink. If body is not empty, it is parsed as a text/template
+// which renders the request body from the Message, e.g. `{"alert": {{printf "%q" .Title}}}`.
+func NewWebhook(url string, body string) (*Webhook, error) {
+	webhook := &Webhook{URL: url}
+	if body != "" {
+		tmpl, err := template.New("webhook").Parse(body)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Template = tmpl
+	}
+	return webhook, nil
+}
+
+type webhookBody struct {
+	Title  string    `json:"title"`
+	Text   string    `json:"text"`
+	Urgent bool      `json:"urgent"`
+	Time   time.Time `json:"time"`
+	Rule   string    `json:"rule"`
+	Event  string    `json:"event"`
+	Value  float64   `json:"value"`
+}
+
+// Send posts the message.
+func (w *Webhook) Send(ctx context.Context, message Message) error {
+	var body bytes.Buffer
+	if w.Template != nil {
+		if err := w.Template.Execute(&body, message); err != nil {
+			return err
+		}
+	} else {
+		err := json.NewEncoder(&body).Encode(webhookBody{
+			Title:  message.Title,
+			Text:   message.Text,
+			Urgent: message.Urgent,
+			Time:   message.Time,
+			Rule:   message.Event.Alert.Rule.Name,
+			Event:  message.Event.Type.String(),
+			Value:  message.Event.Alert.Value,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return post(ctx, w.Client, w.URL, w.Header, "application/json", &body)
+}
+
+// Slack posts messages to a Slack-compatible incoming webhook.
+// Discord accepts the same messages when "/slack" is appended to its webhook URL.
+type Slack struct {
+	// URL is the incoming webhook's URL.
+	URL string
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewSlack creates a sink for a Slack-compatible incoming webhook.
+func NewSlack(url string) *Slack {
+	return &Slack{URL: url}
+}
+
+// Send posts the message.
+func (s *Slack) Send(ctx context.Context, message Message) error {
+	icon := ":white_check_mark:"
+	if message.Urgent {
+		icon = ":rotating_light:"
+	}
+	body, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("%s *%s*\n%s", icon, message.Title, message.Text),
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, s.Client, s.URL, nil, "application/json", bytes.NewReader(body))
+}
+
+// Discord posts messages to a Discord webhook.
+type Discord struct {
+	// URL is the webhook's URL.
+	URL string
+	// Client is the HTTP client to use. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewDiscord creates a sink for a Discord webhook.
+func NewDiscord(url string) *Discord {
+	return &Discord{URL: url}
+}
+
+// Send posts the message.
+func (d *Discord) Send(ctx context.Context, message Message) error {
+	body, err := json.Marshal(map[string]string{
+		"content": fmt.Sprintf("**%s**\n%s", message.Title, message.Text),
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, d.Client, d.URL, nil, "application/json", bytes.NewReader(body))
+}
+
+func post(ctx context.Context, client *http.Client, url string, header http.Header, contentType string, body io.Reader) error {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		text, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return &HTTPError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(text))}
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
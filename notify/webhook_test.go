@@ -0,0 +1,184 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2/alert"
+)
+
+// request is a request received by a stand-in server.
+type request struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+// newServer starts a stand-in server which records each request and responds with the given status.
+func newServer(t *testing.T, status int) (*httptest.Server, <-chan request) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+		}
+		requests <- request{r.Method, r.URL.Path, r.Header, string(body)}
+		w.WriteHeader(status)
+		w.Write([]byte("nope\n"))
+	}))
+	return server, requests
+}
+
+func testMessage(eventType alert.EventType) Message {
+	return MessageFor(alert.Event{
+		Type: eventType,
+		Time: time.Date(2019, 5, 4, 10, 0, 0, 0, time.UTC),
+		Alert: alert.Alert{
+			Rule:  alert.Rule{Name: "brisket done", Kind: alert.Above, Probe: 1, Threshold: 93},
+			Value: 93.5,
+		},
+	})
+}
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		header   http.Header
+		check    func(t *testing.T, r request)
+	}{
+		{
+			name:   "default body",
+			header: http.Header{"Authorization": {"Bearer secret"}},
+			check: func(t *testing.T, r request) {
+				var body webhookBody
+				if err := json.Unmarshal([]byte(r.body), &body); err != nil {
+					t.Fatalf("body %q is not JSON: %v", r.body, err)
+				}
+				want := webhookBody{
+					Title:  "Alert fired: brisket done",
+					Text:   "Probe 2 is above 93.0°C, at 93.5°C",
+					Urgent: true,
+					Time:   time.Date(2019, 5, 4, 10, 0, 0, 0, time.UTC),
+					Rule:   "brisket done",
+					Event:  "fired",
+					Value:  93.5,
+				}
+				if body != want {
+					t.Errorf("got body %+v, want %+v", body, want)
+				}
+				if got := r.header.Get("Authorization"); got != "Bearer secret" {
+					t.Errorf("got Authorization %q, want the configured header", got)
+				}
+			},
+		},
+		{
+			name:     "template",
+			template: `{"alert": {{printf "%q" .Title}}}`,
+			check: func(t *testing.T, r request) {
+				if want := `{"alert": "Alert fired: brisket done"}`; r.body != want {
+					t.Errorf("got body %q, want %q", r.body, want)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := newServer(t, http.StatusNoContent)
+			defer server.Close()
+			webhook, err := NewWebhook(server.URL+"/hook", test.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			webhook.Header = test.header
+			if err = webhook.Send(context.Background(), testMessage(alert.Fired)); err != nil {
+				t.Fatal(err)
+			}
+			r := <-requests
+			if r.method != http.MethodPost || r.path != "/hook" {
+				t.Errorf("got %s %s, want POST /hook", r.method, r.path)
+			}
+			if got := r.header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("got Content-Type %q", got)
+			}
+			test.check(t, r)
+		})
+	}
+}
+
+func TestWebhookTemplateError(t *testing.T) {
+	if _, err := NewWebhook("http://localhost", "{{.Title"); err == nil {
+		t.Error("expected an invalid template to be rejected")
+	}
+}
+
+func TestChatSinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		sink  func(url string) Sink
+		event alert.EventType
+		key   string
+		want  string
+	}{
+		{"slack fired", func(url string) Sink { return NewSlack(url) }, alert.Fired,
+			"text", ":rotating_light: *Alert fired: brisket done*\nProbe 2 is above 93.0°C, at 93.5°C"},
+		{"slack resolved", func(url string) Sink { return NewSlack(url) }, alert.Resolved,
+			"text", ":white_check_mark: *Alert resolved: brisket done*\nProbe 2 is back below 93.0°C, at 93.5°C"},
+		{"discord", func(url string) Sink { return NewDiscord(url) }, alert.Fired,
+			"content", "**Alert fired: brisket done**\nProbe 2 is above 93.0°C, at 93.5°C"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := newServer(t, http.StatusOK)
+			defer server.Close()
+			if err := test.sink(server.URL).Send(context.Background(), testMessage(test.event)); err != nil {
+				t.Fatal(err)
+			}
+			var body map[string]string
+			if err := json.Unmarshal([]byte((<-requests).body), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body[test.key] != test.want {
+				t.Errorf("got %s %q, want %q", test.key, body[test.key], test.want)
+			}
+		})
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	server, _ := newServer(t, http.StatusBadRequest)
+	defer server.Close()
+	err := NewSlack(server.URL).Send(context.Background(), testMessage(alert.Fired))
+	httpErr, ok := err.(*HTTPError)
+	if !ok {
+		t.Fatalf("got error %v, want an *HTTPError", err)
+	}
+	if httpErr.StatusCode != http.StatusBadRequest || httpErr.Body != "nope" {
+		t.Errorf("got %+v, want status 400 and body nope", httpErr)
+	}
+	if !strings.Contains(err.Error(), "400") {
+		t.Errorf("error %q doesn't mention the status", err)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package os
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	capNetAdmin = 12
+	capNetRaw   = 13
+)
+
+// ErrMissingCapabilities is returned when the process isn't allowed to open a raw HCI socket.
+var ErrMissingCapabilities = errors.New("missing CAP_NET_ADMIN/CAP_NET_RAW capabilities; " +
+	"run as root or grant them with: setcap 'cap_net_raw,cap_net_admin+eip' <binary>")
+
+// checkCapabilities makes sure we hold the capabilities needed for HCI access.
+// If the effective capability set can't be determined, we let the HCI socket report the problem.
+func checkCapabilities() error {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			return nil
+		}
+		required := uint64(1)<<capNetAdmin | uint64(1)<<capNetRaw
+		if caps&required != required {
+			return ErrMissingCapabilities
+		}
+		return nil
+	}
+	return nil
+}
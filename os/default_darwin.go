@@ -16,11 +16,24 @@
 package os
 
 import (
+	"fmt"
+
 	"github.com/go-ble/ble"
 	"github.com/go-ble/ble/darwin"
 )
 
-// DefaultDevice ...
-func DefaultDevice() (d ble.Device, err error) {
-	return darwin.NewDevice()
+// DefaultDevice creates a device using the platform's default implementation.
+func DefaultDevice(opts ...ble.Option) (d ble.Device, err error) {
+	return NewDevice("default", opts...)
+}
+
+// NewDevice creates a device using the named implementation.
+// On OS X, "default" and "darwin" both select the CoreBluetooth implementation.
+func NewDevice(impl string, opts ...ble.Option) (d ble.Device, err error) {
+	switch impl {
+	case "", "default", "darwin":
+	default:
+		return nil, fmt.Errorf("unsupported device implementation: %s", impl)
+	}
+	return darwin.NewDevice(opts...)
 }
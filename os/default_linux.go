@@ -16,11 +16,27 @@
 package os
 
 import (
+	"fmt"
+
 	"github.com/go-ble/ble"
 	"github.com/go-ble/ble/linux"
 )
 
-// DefaultDevice ...
-func DefaultDevice() (d ble.Device, err error) {
-	return linux.NewDevice()
+// DefaultDevice creates a device using the platform's default implementation.
+func DefaultDevice(opts ...ble.Option) (d ble.Device, err error) {
+	return NewDevice("default", opts...)
+}
+
+// NewDevice creates a device using the named implementation.
+// On Linux, "default" and "linux" both select the HCI implementation.
+func NewDevice(impl string, opts ...ble.Option) (d ble.Device, err error) {
+	switch impl {
+	case "", "default", "linux":
+	default:
+		return nil, fmt.Errorf("unsupported device implementation: %s", impl)
+	}
+	if err = checkCapabilities(); err != nil {
+		return nil, err
+	}
+	return linux.NewDevice(opts...)
 }
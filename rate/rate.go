@@ -0,0 +1,208 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package rate computes how fast each probe's temperature is changing,
+// and raises trend alarms such as "pit dropping faster than 2 °C/min".
+package rate
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+// Configuration configures a Calculator.
+type Configuration struct {
+	// Window is the period over which rates of change are measured.
+	Window time.Duration
+	// Alarms are the trend alarms to evaluate.
+	Alarms []Alarm
+	// Suppressor, if set, stops alarms from being triggered while it reports readings as suppressed,
+	// e.g. while the cooker's lid is open.
+	Suppressor ibbq.Suppressor
+}
+
+// DefaultConfiguration is a somewhat sane default.
+var DefaultConfiguration = Configuration{
+	Window: 5 * time.Minute,
+}
+
+// Alarm is a trend alarm rule, triggered while a probe's temperature changes faster than a threshold.
+type Alarm struct {
+	// Name identifies the alarm, e.g. "fire dying".
+	Name string
+	// Probe is the index of the probe to watch.
+	Probe int
+	// Falling selects alarms on dropping temperatures, rather than rising ones.
+	Falling bool
+	// Threshold is the rate of change, in celsius per minute, beyond which the alarm triggers.
+	Threshold float64
+	// MinDuration is how long the rate must stay beyond the threshold before the alarm triggers.
+	MinDuration time.Duration
+}
+
+// AlarmEvent reports an alarm being triggered or cleared.
+type AlarmEvent struct {
+	Alarm Alarm
+	// Triggered is set when the alarm was triggered, and unset when it was cleared.
+	Triggered bool
+	// Time is when the alarm was triggered or cleared.
+	Time time.Time
+	// Rate is the probe's rate of change at the time, in celsius per minute.
+	Rate float64
+}
+
+// AlarmHandler is a callback for trend alarm events.
+type AlarmHandler func(AlarmEvent)
+
+type sample struct {
+	time        time.Time
+	temperature float64
+}
+
+type alarmState struct {
+	beyondSince time.Time
+	triggered   bool
+}
+
+// Calculator computes each probe's rate of change over a sliding window. It is safe for concurrent use.
+type Calculator struct {
+	mu      sync.Mutex
+	config  Configuration
+	handler AlarmHandler
+	samples map[int][]sample
+	alarms  []alarmState
+}
+
+// NewCalculator creates a calculator. The handler, which may be nil, is called with each trend alarm event.
+func NewCalculator(config Configuration, handler AlarmHandler) *Calculator {
+	return &Calculator{
+		config:  config,
+		handler: handler,
+		samples: map[int][]sample{},
+		alarms:  make([]alarmState, len(config.Alarms)),
+	}
+}
+
+// Update feeds a reading to the calculator. It is meant to be called from a reading handler.
+func (c *Calculator) Update(reading ibbq.Reading) {
+	c.mu.Lock()
+	for probe, temperature := range reading.Temperatures {
+		if !ibbq.ProbeConnected(temperature) {
+			delete(c.samples, probe)
+			continue
+		}
+		samples := append(c.samples[probe], sample{reading.Time, temperature})
+		start := 0
+		for start < len(samples) && reading.Time.Sub(samples[start].time) > c.config.Window {
+			start++
+		}
+		c.samples[probe] = append(samples[:0], samples[start:]...)
+	}
+	events := c.evaluateAlarms(reading.Time)
+	handler := c.handler
+	c.mu.Unlock()
+	if handler != nil {
+		for _, event := range events {
+			handler(event)
+		}
+	}
+}
+
+// Rate returns a probe's rate of change, in celsius per minute.
+// No rate is available until readings covering at least half of the window have been received.
+func (c *Calculator) Rate(probe int) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate(probe)
+}
+
+// Triggered returns the alarms which are currently triggered.
+func (c *Calculator) Triggered() []Alarm {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var alarms []Alarm
+	for i, state := range c.alarms {
+		if state.triggered {
+			alarms = append(alarms, c.config.Alarms[i])
+		}
+	}
+	return alarms
+}
+
+func (c *Calculator) rate(probe int) (float64, bool) {
+	samples := c.samples[probe]
+	if len(samples) < 2 || samples[len(samples)-1].time.Sub(samples[0].time) < c.config.Window/2 {
+		return 0, false
+	}
+	rate := slope(samples)
+	return rate, !math.IsNaN(rate)
+}
+
+func (c *Calculator) evaluateAlarms(t time.Time) []AlarmEvent {
+	var events []AlarmEvent
+	suppressed := c.config.Suppressor != nil && c.config.Suppressor.Suppressed()
+	for i, alarm := range c.config.Alarms {
+		state := &c.alarms[i]
+		if suppressed {
+			state.beyondSince = time.Time{}
+			continue
+		}
+		rate, ok := c.rate(alarm.Probe)
+		beyond := ok && ((alarm.Falling && -rate > alarm.Threshold) || (!alarm.Falling && rate > alarm.Threshold))
+		switch {
+		case beyond && !state.triggered:
+			if state.beyondSince.IsZero() {
+				state.beyondSince = t
+			}
+			if t.Sub(state.beyondSince) >= alarm.MinDuration {
+				state.triggered = true
+				events = append(events, AlarmEvent{Alarm: alarm, Triggered: true, Time: t, Rate: rate})
+			}
+		case !beyond && state.triggered:
+			state.triggered = false
+			state.beyondSince = time.Time{}
+			events = append(events, AlarmEvent{Alarm: alarm, Triggered: false, Time: t, Rate: rate})
+		case !beyond:
+			state.beyondSince = time.Time{}
+		}
+	}
+	return events
+}
+
+// slope fits a line to the samples by least squares and returns its slope, in celsius per minute.
+func slope(samples []sample) float64 {
+	n := float64(len(samples))
+	start := samples[0].time
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.time.Sub(start).Minutes()
+		sumY += s.temperature
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var sxx, sxy float64
+	for _, s := range samples {
+		x := s.time.Sub(start).Minutes() - meanX
+		sxx += x * x
+		sxy += x * (s.temperature - meanY)
+	}
+	if sxx == 0 {
+		return math.NaN()
+	}
+	return sxy / sxx
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package rate
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+type suppressor struct {
+	on bool
+}
+
+func (s *suppressor) Suppressed() bool { return s.on }
+
+var start = time.Unix(1600000000, 0)
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		minutes float64
+		probe   func(minutes float64) float64
+		want    float64
+		wantOK  bool
+	}{
+		{"rising", 5, func(m float64) float64 { return 20 + 2*m }, 2, true},
+		{"falling", 5, func(m float64) float64 { return 200 - 0.5*m }, -0.5, true},
+		{"steady", 5, func(m float64) float64 { return 100 }, 0, true},
+		{"only the window is measured", 20, func(m float64) float64 { return 20 + 3*math.Max(m-10, 0) }, 3, true},
+		{"half a window", 2.5, func(m float64) float64 { return 20 + m }, 1, true},
+		{"less than half a window", 2, func(m float64) float64 { return 20 + m }, 0, false},
+		{"unplugged", 5, func(m float64) float64 { return ibbq.UnpluggedTemperature }, 0, false},
+		{"unplugged during the window", 10, func(m float64) float64 {
+			if m > 8 && m < 9 {
+				return ibbq.UnpluggedTemperature
+			}
+			return 20 + m
+		}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewCalculator(DefaultConfiguration, nil)
+			for seconds := 0; float64(seconds) <= test.minutes*60; seconds += 10 {
+				minutes := float64(seconds) / 60
+				c.Update(ibbq.Reading{Time: start.Add(time.Duration(seconds) * time.Second), Temperatures: []float64{test.probe(minutes)}})
+			}
+			got, ok := c.Rate(0)
+			if ok != test.wantOK || math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("got %v, %v, want %v, %v", got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestAlarms(t *testing.T) {
+	dying := Alarm{Name: "fire dying", Falling: true, Threshold: 1, MinDuration: time.Minute}
+	rising := Alarm{Name: "rising", Threshold: 1}
+	type event struct {
+		minute    int
+		alarm     string
+		triggered bool
+	}
+	tests := []struct {
+		name       string
+		alarms     []Alarm
+		rates      []float64
+		suppressed func(minute int) bool
+		want       []event
+	}{
+		{"falling", []Alarm{dying}, []float64{0, 0, 0, -2, -2, -2, -2, -2, -2, -2, 0, 0, 0, 0, 0}, nil, []event{{5, "fire dying", true}, {11, "fire dying", false}}},
+		{"not for long enough", []Alarm{dying}, []float64{0, 0, 0, -2, 0, 0, 0}, nil, nil},
+		{"rising", []Alarm{rising, dying}, []float64{0, 0, 0, 3, 3, 3, 3, 0, 0, 0}, nil, []event{{4, "rising", true}, {8, "rising", false}}},
+		{"falling doesn't trigger a rising alarm", []Alarm{rising}, []float64{-3, -3, -3, -3, -3, -3}, nil, nil},
+		{"suppressed", []Alarm{dying}, []float64{0, 0, 0, -2, -2, -2, -2, -2, -2, -2, -2, -2}, func(minute int) bool { return minute >= 4 && minute < 8 }, []event{{9, "fire dying", true}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []event
+			s := &suppressor{}
+			config := Configuration{Window: 2 * time.Minute, Alarms: test.alarms, Suppressor: s}
+			c := NewCalculator(config, func(e AlarmEvent) {
+				got = append(got, event{int(e.Time.Sub(start) / time.Minute), e.Alarm.Name, e.Triggered})
+			})
+			temperature := 200.0
+			for minute, rate := range test.rates {
+				s.on = test.suppressed != nil && test.suppressed(minute)
+				for seconds := 0; seconds < 60; seconds += 30 {
+					c.Update(ibbq.Reading{Time: start.Add(time.Duration(minute)*time.Minute + time.Duration(seconds)*time.Second), Temperatures: []float64{temperature}})
+					temperature += rate / 2
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTriggered(t *testing.T) {
+	alarms := []Alarm{{Name: "a", Threshold: 1}, {Name: "b", Threshold: 10}}
+	c := NewCalculator(Configuration{Window: time.Minute, Alarms: alarms}, nil)
+	for seconds := 0; seconds <= 60; seconds += 10 {
+		c.Update(ibbq.Reading{Time: start.Add(time.Duration(seconds) * time.Second), Temperatures: []float64{20 + 5*float64(seconds)/60}})
+	}
+	if got := c.Triggered(); !reflect.DeepEqual(got, alarms[:1]) {
+		t.Errorf("got %v, want %v", got, alarms[:1])
+	}
+}
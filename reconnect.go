@@ -0,0 +1,107 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// IbbqFactory creates an Ibbq, with its handlers, ready to connect.
+type IbbqFactory func(ctx context.Context) (*Ibbq, error)
+
+// Reconnector keeps a thermometer connected. An Ibbq can't be reused once its session ends,
+// so a new one is created for each connection attempt.
+type Reconnector struct {
+	// MinDelay is the delay before reconnecting after a connection is lost.
+	MinDelay time.Duration
+	// MaxDelay is the longest delay between failed connection attempts, which back off exponentially from MinDelay.
+	MaxDelay time.Duration
+
+	factory    IbbqFactory
+	mu         sync.Mutex
+	current    *Ibbq
+	reconnects int
+}
+
+// NewReconnector creates a reconnector which uses the factory to create each Ibbq.
+func NewReconnector(factory IbbqFactory) *Reconnector {
+	return &Reconnector{
+		MinDelay: 5 * time.Second,
+		MaxDelay: 5 * time.Minute,
+		factory:  factory,
+	}
+}
+
+// Current returns the most recently created Ibbq, or nil if there hasn't been one.
+func (r *Reconnector) Current() *Ibbq {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reconnects returns how many times the connection has been re-established after being lost.
+func (r *Reconnector) Reconnects() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reconnects
+}
+
+// Run connects, and reconnects whenever the connection is lost, until the context is done.
+// Each Ibbq is closed once its session ends.
+func (r *Reconnector) Run(ctx context.Context) error {
+	delay := r.MinDelay
+	connected := false
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bbq, err := r.factory(ctx)
+		if err == nil {
+			r.mu.Lock()
+			r.current = bbq
+			r.mu.Unlock()
+			if err = bbq.Connect(); err == nil {
+				r.mu.Lock()
+				if connected {
+					r.reconnects++
+				}
+				r.mu.Unlock()
+				connected = true
+				delay = r.MinDelay
+				select {
+				case <-bbq.Disconnected():
+				case <-ctx.Done():
+				}
+			}
+			bbq.Close()
+		}
+		if err != nil {
+			logger.Warn("Connection failed, will retry", "delay", delay, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if err != nil {
+			if delay *= 2; delay > r.MaxDelay {
+				delay = r.MaxDelay
+			}
+		}
+	}
+}
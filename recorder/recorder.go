@@ -0,0 +1,344 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package recorder writes readings to CSV or JSON Lines files, for analysis in spreadsheets and other tools.
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mgutz/logxi/v1"
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+var logger = log.New("recorder")
+
+// SetLogger replaces the package's logger, e.g. to log to stderr, or to discard logs with log.NullLog.
+// It should be called before creating a Recorder.
+func SetLogger(l log.Logger) {
+	logger = l
+}
+
+// csvTimeFormat is understood by spreadsheets, unlike RFC 3339.
+const csvTimeFormat = "2006-01-02 15:04:05"
+
+// Format is a file format.
+type Format string
+
+const (
+	// CSV writes a header row of probe names, then a row per reading, in local time. Unplugged probes are left empty.
+	CSV Format = "csv"
+	// JSONLines writes a JSON object per line, holding the reading's time and each probe's temperature by name.
+	// Unplugged probes are null.
+	JSONLines Format = "jsonl"
+)
+
+// Configuration configures a Recorder.
+type Configuration struct {
+	// Path is the file to record to. Rotated files are renamed alongside it, with the date and a sequence number
+	// added before the extension, e.g. cook-20190504.csv and cook-20190504-1.csv.
+	Path string
+	// Format is the file format.
+	Format Format
+	// ProbeNames names each probe's column, by probe index. Probes without a name are called probe1, probe2, etc.
+	ProbeNames []string
+	// MaxSize, if set, is the size in bytes beyond which the file is rotated.
+	MaxSize int64
+	// Daily selects rotating the file at midnight.
+	Daily bool
+	// SyncInterval is the longest time written readings may go without being synced to disk, including after
+	// readings stop arriving. Zero syncs after every reading.
+	SyncInterval time.Duration
+}
+
+// DefaultConfiguration is a somewhat sane default, which only needs a path.
+var DefaultConfiguration = Configuration{
+	Format:       CSV,
+	SyncInterval: 10 * time.Second,
+}
+
+// Recorder writes readings to a file. If the file already exists, readings are appended to it. It is safe for
+// concurrent use.
+type Recorder struct {
+	mu       sync.Mutex
+	config   Configuration
+	file     *os.File
+	size     int64
+	day      time.Time
+	columns  []string
+	lastSync time.Time
+	dirty    bool
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRecorder opens, or creates, the file and prepares to record to it.
+func NewRecorder(config Configuration) (*Recorder, error) {
+	switch config.Format {
+	case CSV, JSONLines:
+	default:
+		return nil, fmt.Errorf("unknown format %q", config.Format)
+	}
+	r := &Recorder{config: config, stop: make(chan struct{}), done: make(chan struct{})}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	if config.SyncInterval > 0 {
+		go r.syncPeriodically()
+	} else {
+		close(r.done)
+	}
+	return r, nil
+}
+
+// syncPeriodically syncs readings which were written since the last sync, so that they reach the disk
+// even if no more readings arrive, until the recorder is closed.
+func (r *Recorder) syncPeriodically() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		r.mu.Lock()
+		var err error
+		if r.file != nil {
+			err = r.sync()
+		}
+		r.mu.Unlock()
+		if err != nil {
+			logger.Error("Error syncing recording", "path", r.config.Path, "err", err)
+		}
+	}
+}
+
+// open opens the file for appending, picking up the columns of a CSV file which is being resumed.
+func (r *Recorder) open() error {
+	file, err := os.OpenFile(r.config.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file, r.size, r.columns = file, info.Size(), nil
+	r.day = day(time.Now())
+	r.lastSync = time.Now()
+	if r.size == 0 {
+		return nil
+	}
+	r.day = day(info.ModTime())
+	if r.config.Format == CSV {
+		header, err := bufio.NewReader(io.NewSectionReader(file, 0, r.size)).ReadString('\n')
+		if err != nil && err != io.EOF {
+			file.Close()
+			return err
+		}
+		if fields, err := csv.NewReader(strings.NewReader(header)).Read(); err == nil && len(fields) > 1 {
+			r.columns = fields[1:]
+		}
+	}
+	logger.Info("Resuming recording", "path", r.config.Path, "size", r.size)
+	return nil
+}
+
+func day(t time.Time) time.Time {
+	year, month, d := t.Date()
+	return time.Date(year, month, d, 0, 0, 0, 0, t.Location())
+}
+
+// Update records a reading, logging any error. It is meant to be called from a reading handler.
+func (r *Recorder) Update(reading ibbq.Reading) {
+	if err := r.Write(reading); err != nil {
+		logger.Error("Error recording reading", "path", r.config.Path, "err", err)
+	}
+}
+
+// Write records a reading.
+func (r *Recorder) Write(reading ibbq.Reading) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	if r.shouldRotate(reading.Time) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if r.columns == nil {
+		r.columns = r.probeNames(len(reading.Temperatures))
+		if r.config.Format == CSV {
+			if err := writeCSV(&buf, append([]string{"time"}, r.columns...)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.format(&buf, reading); err != nil {
+		return err
+	}
+	n, err := r.file.Write(buf.Bytes())
+	r.size += int64(n)
+	if err != nil {
+		return err
+	}
+	r.dirty = true
+	if time.Since(r.lastSync) >= r.config.SyncInterval {
+		return r.sync()
+	}
+	return nil
+}
+
+func (r *Recorder) probeNames(probes int) []string {
+	names := make([]string, probes)
+	for probe := range names {
+		if probe < len(r.config.ProbeNames) && r.config.ProbeNames[probe] != "" {
+			names[probe] = r.config.ProbeNames[probe]
+		} else {
+			names[probe] = "probe" + strconv.Itoa(probe+1)
+		}
+	}
+	return names
+}
+
+func (r *Recorder) format(w *bytes.Buffer, reading ibbq.Reading) error {
+	if r.config.Format == CSV {
+		record := make([]string, len(r.columns)+1)
+		record[0] = reading.Time.Format(csvTimeFormat)
+		for probe := range r.columns {
+			if probe < len(reading.Temperatures) && ibbq.ProbeConnected(reading.Temperatures[probe]) {
+				record[probe+1] = strconv.FormatFloat(reading.Temperatures[probe], 'f', -1, 64)
+			}
+		}
+		return writeCSV(w, record)
+	}
+	// written by hand, to keep the probes in order
+	fmt.Fprintf(w, `{"time":%q,"temperatures":{`, reading.Time.Format(time.RFC3339))
+	for probe, name := range r.columns {
+		if probe > 0 {
+			w.WriteByte(',')
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		w.Write(key)
+		w.WriteByte(':')
+		if probe < len(reading.Temperatures) && ibbq.ProbeConnected(reading.Temperatures[probe]) {
+			w.WriteString(strconv.FormatFloat(reading.Temperatures[probe], 'f', -1, 64))
+		} else {
+			w.WriteString("null")
+		}
+	}
+	w.WriteString("}}\n")
+	return nil
+}
+
+func writeCSV(w io.Writer, record []string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(record)
+	cw.Flush()
+	return cw.Error()
+}
+
+func (r *Recorder) shouldRotate(t time.Time) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.config.MaxSize > 0 && r.size >= r.config.MaxSize {
+		return true
+	}
+	return r.config.Daily && day(t).After(r.day)
+}
+
+// rotate renames the current file aside, dated with the day it covers, and starts a new one.
+func (r *Recorder) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(r.config.Path)
+	base := strings.TrimSuffix(r.config.Path, ext) + "-" + r.day.Format("20060102")
+	name := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		name = base + "-" + strconv.Itoa(i) + ext
+	}
+	if err := os.Rename(r.config.Path, name); err != nil {
+		return err
+	}
+	logger.Info("Rotated recording", "path", name)
+	return r.open()
+}
+
+func (r *Recorder) sync() error {
+	r.lastSync = time.Now()
+	if !r.dirty {
+		return nil
+	}
+	r.dirty = false
+	return r.file.Sync()
+}
+
+func (r *Recorder) closeFile() error {
+	err := r.sync()
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	r.file = nil
+	return err
+}
+
+// Sync syncs the recorded readings to disk.
+func (r *Recorder) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return r.sync()
+}
+
+// Close syncs and closes the file.
+func (r *Recorder) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.closeFile()
+}
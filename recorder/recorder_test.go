@@ -0,0 +1,179 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package recorder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRecorder(t *testing.T) {
+	at := time.Date(2019, 5, 4, 10, 0, 0, 0, time.Local)
+	readings := []ibbq.Reading{
+		{Time: at, Temperatures: []float64{121.2, ibbq.UnpluggedTemperature}},
+		{Time: at.Add(time.Second), Temperatures: []float64{121.25, 68.4}},
+	}
+	tests := []struct {
+		format Format
+		names  []string
+		want   string
+	}{
+		{CSV, []string{"pit"}, "time,pit,probe2\n" +
+			"2019-05-04 10:00:00,121.2,\n" +
+			"2019-05-04 10:00:01,121.25,68.4\n"},
+		{JSONLines, []string{"", "brisket"}, `{"time":"` + at.Format(time.RFC3339) + `","temperatures":{"probe1":121.2,"brisket":null}}` + "\n" +
+			`{"time":"` + at.Add(time.Second).Format(time.RFC3339) + `","temperatures":{"probe1":121.25,"brisket":68.4}}` + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			config := DefaultConfiguration
+			config.Path = filepath.Join(dir, "cook")
+			config.Format = test.format
+			config.ProbeNames = test.names
+			r, err := NewRecorder(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, reading := range readings {
+				if err = r.Write(reading); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := readFile(t, config.Path); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if err = r.Write(readings[0]); err != os.ErrClosed {
+				t.Errorf("writing after closing returned %v, want %v", err, os.ErrClosed)
+			}
+		})
+	}
+}
+
+func TestRecorderResumesCSV(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	config := DefaultConfiguration
+	config.Path = filepath.Join(dir, "cook.csv")
+	if err := ioutil.WriteFile(config.Path, []byte("time,pit,brisket\n2019-05-04 10:00:00,120,60\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the names are ignored in favour of the file's existing columns
+	config.ProbeNames = []string{"a", "b", "c"}
+	r, err := NewRecorder(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Update(ibbq.Reading{Time: time.Date(2019, 5, 4, 10, 0, 1, 0, time.Local), Temperatures: []float64{121, 61, 20}})
+	r.Close()
+	want := "time,pit,brisket\n2019-05-04 10:00:00,120,60\n2019-05-04 10:00:01,121,61\n"
+	if got := readFile(t, config.Path); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRecorderRotates(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	config := DefaultConfiguration
+	config.Path = filepath.Join(dir, "cook.csv")
+	config.MaxSize = 30
+	r, err := NewRecorder(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2019, 5, 4, 10, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		if err = r.Write(ibbq.Reading{Time: at.Add(time.Duration(i) * time.Second), Temperatures: []float64{120}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+	today := time.Now().Format("20060102")
+	want := map[string]string{
+		"cook-" + today + ".csv":   "time,probe1\n2019-05-04 10:00:00,120\n",
+		"cook-" + today + "-1.csv": "time,probe1\n2019-05-04 10:00:01,120\n",
+		"cook.csv":                 "time,probe1\n2019-05-04 10:00:02,120\n",
+	}
+	for name, contents := range want {
+		if got := readFile(t, filepath.Join(dir, name)); got != contents {
+			t.Errorf("got %s %q, want %q", name, got, contents)
+		}
+	}
+}
+
+func TestRecorderSyncsPeriodically(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	config := DefaultConfiguration
+	config.Path = filepath.Join(dir, "cook.csv")
+	config.SyncInterval = 10 * time.Millisecond
+	r, err := NewRecorder(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.Write(ibbq.Reading{Time: time.Now(), Temperatures: []float64{120}}); err != nil {
+		t.Fatal(err)
+	}
+	// no more readings arrive, so only the ticker can sync the one written
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mu.Lock()
+		dirty := r.dirty
+		r.mu.Unlock()
+		if !dirty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the reading wasn't synced")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-r.done:
+	default:
+		t.Error("closing didn't stop syncing")
+	}
+}
@@ -0,0 +1,142 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// SamplingMode controls how often the device sends real-time data.
+type SamplingMode string
+
+const (
+	// ContinuousSampling leaves real-time data switched on, so the device sends a reading about once a second.
+	ContinuousSampling SamplingMode = "continuous"
+	// IntervalSampling switches real-time data on for one reading per sampling interval.
+	IntervalSampling SamplingMode = "interval"
+	// AdaptiveSampling behaves like interval sampling, but uses the fast sampling interval
+	// while any probe's temperature is changing faster than the adaptive sampling threshold.
+	AdaptiveSampling SamplingMode = "adaptive"
+)
+
+// sampleTimeout bounds how long we wait for a reading after switching real-time data on.
+const sampleTimeout = 10 * time.Second
+
+// dutyCycle measures the fraction of time for which real-time data is switched on,
+// which is what sampling saves battery on.
+type dutyCycle struct {
+	mu     sync.Mutex
+	on     bool
+	start  time.Time
+	since  time.Time
+	onTime time.Duration
+}
+
+// set records real-time data being switched on or off.
+func (d *dutyCycle) set(on bool, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.start.IsZero() {
+		d.start = now
+	} else if d.on {
+		d.onTime += now.Sub(d.since)
+	}
+	d.on = on
+	d.since = now
+}
+
+// take returns the duty cycle since it was last taken, and starts measuring afresh.
+func (d *dutyCycle) take(now time.Time) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.start.IsZero() {
+		return 0
+	}
+	onTime := d.onTime
+	if d.on {
+		onTime += now.Sub(d.since)
+	}
+	duty := 1.0
+	if elapsed := now.Sub(d.start); elapsed > 0 {
+		duty = float64(onTime) / float64(elapsed)
+	} else if !d.on {
+		duty = 0
+	}
+	d.start, d.since, d.onTime = now, now, 0
+	return duty
+}
+
+// runSampler switches real-time data on and off so that we only take one reading per sampling interval.
+// Real-time data must already have been enabled when it is called.
+func (ibbq *Ibbq) runSampler(s *session) {
+	var previous Reading
+	for {
+		select {
+		case <-s.sampled:
+		case <-time.After(sampleTimeout):
+			logger.Warn("No real-time data received while sampling")
+		case <-s.done:
+			return
+		}
+		if err := ibbq.writeSetting(realTimeDataDisable); err != nil {
+			logger.Error("Unable to disable real-time data", "err", err)
+			ibbq.guard.reportError(err)
+			return
+		}
+		ibbq.duty.set(false, time.Now())
+		current, _ := ibbq.state.lastReading()
+		interval := ibbq.nextSamplingInterval(previous, current)
+		previous = current
+		logger.Debug("Waiting for next sample", "interval", interval)
+		select {
+		case <-time.After(interval):
+		case <-s.done:
+			return
+		}
+		select {
+		case <-s.sampled:
+		default:
+		}
+		if err := ibbq.writeSetting(realTimeDataEnable); err != nil {
+			logger.Error("Unable to enable real-time data", "err", err)
+			ibbq.guard.reportError(err)
+			return
+		}
+		ibbq.duty.set(true, time.Now())
+	}
+}
+
+// nextSamplingInterval picks the time to wait before taking the next sample.
+func (ibbq *Ibbq) nextSamplingInterval(previous, current Reading) time.Duration {
+	if ibbq.config.SamplingMode != AdaptiveSampling || previous.Time.IsZero() {
+		return ibbq.config.SamplingInterval
+	}
+	minutes := current.Time.Sub(previous.Time).Minutes()
+	if minutes <= 0 {
+		return ibbq.config.SamplingInterval
+	}
+	for i, temperature := range current.Temperatures {
+		if i >= len(previous.Temperatures) || !ProbeConnected(temperature) || !ProbeConnected(previous.Temperatures[i]) {
+			continue
+		}
+		if math.Abs(temperature-previous.Temperatures[i])/minutes >= ibbq.config.AdaptiveSamplingThreshold {
+			return ibbq.config.FastSamplingInterval
+		}
+	}
+	return ibbq.config.SamplingInterval
+}
@@ -0,0 +1,151 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Configuration)
+		wantErr bool
+	}{
+		{"default", func(c *Configuration) {}, false},
+		{"continuous ignores intervals", func(c *Configuration) { c.SamplingInterval, c.FastSamplingInterval = 0, 0 }, false},
+		{"interval", func(c *Configuration) { c.SamplingMode = IntervalSampling }, false},
+		{"interval without interval", func(c *Configuration) { c.SamplingMode, c.SamplingInterval = IntervalSampling, 0 }, true},
+		{"interval ignores fast interval", func(c *Configuration) { c.SamplingMode, c.FastSamplingInterval = IntervalSampling, 0 }, false},
+		{"adaptive", func(c *Configuration) { c.SamplingMode = AdaptiveSampling }, false},
+		{"adaptive without interval", func(c *Configuration) { c.SamplingMode, c.SamplingInterval = AdaptiveSampling, 0 }, true},
+		{"adaptive without fast interval", func(c *Configuration) { c.SamplingMode, c.FastSamplingInterval = AdaptiveSampling, 0 }, true},
+		{"adaptive with negative fast interval", func(c *Configuration) { c.SamplingMode, c.FastSamplingInterval = AdaptiveSampling, -time.Second }, true},
+		{"adaptive without threshold", func(c *Configuration) { c.SamplingMode, c.AdaptiveSamplingThreshold = AdaptiveSampling, 0 }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfiguration
+			test.change(&config)
+			if err := config.validate(); (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewConfigurationValidates(t *testing.T) {
+	defer func(config Configuration) { DefaultConfiguration = config }(DefaultConfiguration)
+	DefaultConfiguration.SamplingMode = AdaptiveSampling
+	DefaultConfiguration.AdaptiveSamplingThreshold = 0
+	if _, err := NewConfiguration(time.Minute, time.Minute); err == nil {
+		t.Error("an invalid sampling configuration was accepted")
+	}
+}
+
+func TestConnectValidates(t *testing.T) {
+	d := &fakeDevice{}
+	bbq, _ := newTestIbbq(t, context.Background(), d, SerialDispatch)
+	defer bbq.Close()
+	bbq.config.SamplingInterval = 0
+	if err := bbq.Connect(); err == nil {
+		t.Fatal("an invalid sampling configuration was accepted")
+	}
+	if d.dialled() != 0 {
+		t.Error("connected despite the invalid configuration")
+	}
+}
+
+func TestDutyCycle(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	tests := []struct {
+		name    string
+		changes []bool
+		take    int
+		want    float64
+	}{
+		{"never switched on", nil, 10, 0},
+		{"always on", []bool{true}, 10, 1},
+		{"on for one second in ten", []bool{true, false, false, false, false, false, false, false, false, false}, 10, 0.1},
+		{"on for half the time", []bool{true, false, true, false}, 4, 0.5},
+		{"still on", []bool{false, false, true}, 4, 0.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &dutyCycle{}
+			for second, on := range test.changes {
+				d.set(on, at(second))
+			}
+			if got := d.take(at(test.take)); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDutyCycleRestartsWhenTaken(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	d := &dutyCycle{}
+	d.set(true, start)
+	d.set(false, start.Add(time.Second))
+	d.take(start.Add(2 * time.Second))
+	if got := d.take(start.Add(4 * time.Second)); got != 0 {
+		t.Errorf("got %v after real-time data was off since the last take, want 0", got)
+	}
+}
+
+func TestBatteryHandlerReportsDuty(t *testing.T) {
+	tests := []struct {
+		mode    SamplingMode
+		minDuty float64
+		maxDuty float64
+	}{
+		{ContinuousSampling, 1, 1},
+		{IntervalSampling, 0, 0.9},
+	}
+	for _, test := range tests {
+		t.Run(string(test.mode), func(t *testing.T) {
+			d := &fakeDevice{}
+			bbq, _ := newTestIbbq(t, context.Background(), d, SerialDispatch)
+			defer bbq.Close()
+			bbq.config.SamplingMode = test.mode
+			bbq.config.SamplingInterval = 20 * time.Millisecond
+			bbq.config.BatteryPollingInterval = 100 * time.Millisecond
+			batteries := make(chan Battery, 10)
+			bbq.SetBatteryHandler(func(battery Battery) { batteries <- battery })
+			if err := bbq.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			// the first reading is requested on connecting; the second covers a polling interval of sampling
+			for i := 0; i < 2; i++ {
+				select {
+				case battery := <-batteries:
+					if battery.SamplingMode != test.mode || battery.Voltage != 3600 || battery.MaxVoltage != 4200 {
+						t.Errorf("got %+v", battery)
+					}
+					if i == 1 && (battery.RealTimeDuty < test.minDuty || battery.RealTimeDuty > test.maxDuty) {
+						t.Errorf("got duty %v, want between %v and %v", battery.RealTimeDuty, test.minDuty, test.maxDuty)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("no battery reading")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-ble/ble"
+)
+
+// Thermometer is a thermometer found by scanning.
+type Thermometer struct {
+	// Address is the device's address, for Configuration.Address.
+	Address string
+	// Name is the name the device advertises.
+	Name string
+	// RSSI is the signal strength of the advertisement, in dBm.
+	RSSI int
+	// Time is when the advertisement was received.
+	Time time.Time
+}
+
+// ThermometerHandler is a callback for thermometers found by scanning.
+type ThermometerHandler func(Thermometer)
+
+// Scan scans the device for thermometers until the context is done, calling the handler for each advertisement.
+// The same thermometer is usually reported several times. A context which was cancelled or timed out is not an error.
+func Scan(ctx context.Context, d ble.Device, handler ThermometerHandler) error {
+	accept := filter("")
+	err := d.Scan(ctx, true, func(a ble.Advertisement) {
+		if !accept(a) {
+			return
+		}
+		handler(Thermometer{
+			Address: a.Addr().String(),
+			Name:    a.LocalName(),
+			RSSI:    a.RSSI(),
+			Time:    time.Now(),
+		})
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
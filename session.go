@@ -0,0 +1,176 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-ble/ble"
+)
+
+// ErrClosed is returned when using an Ibbq which has been closed.
+var ErrClosed = errors.New("ibbq is closed")
+
+// session is a single connection to the device.
+type session struct {
+	client  ble.Client
+	profile *ble.Profile
+	// done is closed when the session ends.
+	done chan struct{}
+	// sampled receives a value when real-time data arrives.
+	sampled chan struct{}
+	endOnce sync.Once
+	endErr  error
+}
+
+func newSession(client ble.Client) *session {
+	return &session{
+		client:  client,
+		done:    make(chan struct{}),
+		sampled: make(chan struct{}, 1),
+	}
+}
+
+// lifecycle tracks the current session and the goroutines we start.
+type lifecycle struct {
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	session   *session
+	closed    bool
+	closeOnce sync.Once
+	stopOnce  sync.Once
+	stopErr   error
+	cancel    context.CancelFunc
+}
+
+// goTracked runs f in a goroutine which Close waits for.
+func (ibbq *Ibbq) goTracked(f func()) {
+	ibbq.lifecycle.wg.Add(1)
+	go func() {
+		defer ibbq.lifecycle.wg.Done()
+		f()
+	}()
+}
+
+func (ibbq *Ibbq) currentSession() *session {
+	ibbq.lifecycle.mu.Lock()
+	defer ibbq.lifecycle.mu.Unlock()
+	return ibbq.lifecycle.session
+}
+
+func (ibbq *Ibbq) isClosed() bool {
+	ibbq.lifecycle.mu.Lock()
+	defer ibbq.lifecycle.mu.Unlock()
+	return ibbq.lifecycle.closed
+}
+
+// startSession makes s the current session, unless we have been closed.
+func (ibbq *Ibbq) startSession(s *session) error {
+	ibbq.lifecycle.mu.Lock()
+	defer ibbq.lifecycle.mu.Unlock()
+	if ibbq.lifecycle.closed {
+		return ErrClosed
+	}
+	ibbq.lifecycle.session = s
+	return nil
+}
+
+// endSession tears down s, notifying the disconnected handler.
+// Only the first call for a given session has any effect.
+func (ibbq *Ibbq) endSession(s *session) error {
+	s.endOnce.Do(func() {
+		logger.Info("Disconnected", "addr", s.client.Addr().String())
+		close(s.done)
+		ibbq.lifecycle.mu.Lock()
+		if ibbq.lifecycle.session == s {
+			ibbq.lifecycle.session = nil
+		}
+		ibbq.lifecycle.mu.Unlock()
+		s.endErr = ibbq.stopDevice()
+		ibbq.updateStatus(Disconnected)
+		ibbq.notifyDisconnected()
+	})
+	return s.endErr
+}
+
+// stopDevice stops the device, which can't be used again afterwards. Shared devices are left to their owner.
+func (ibbq *Ibbq) stopDevice() error {
+	if ibbq.sharedDevice != nil {
+		return nil
+	}
+	ibbq.lifecycle.stopOnce.Do(func() {
+		ibbq.lifecycle.stopErr = ibbq.device.Stop()
+	})
+	return ibbq.lifecycle.stopErr
+}
+
+// Disconnected returns a channel which is closed when the current session ends.
+// If there is no session, the channel is already closed.
+func (ibbq *Ibbq) Disconnected() <-chan struct{} {
+	if s := ibbq.currentSession(); s != nil {
+		return s.done
+	}
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func (ibbq *Ibbq) handleDisconnects(s *session) {
+	logger.Debug("waiting for disconnect")
+	select {
+	case <-s.client.Disconnected():
+		ibbq.endSession(s)
+	case <-s.done:
+	}
+}
+
+func (ibbq *Ibbq) handleContextClosed(s *session) {
+	logger.Debug("waiting for context to close")
+	select {
+	case <-ibbq.ctx.Done():
+		ibbq.Disconnect(false)
+	case <-s.done:
+	}
+}
+
+// Close disconnects from the device, if connected, and waits for all of our internal goroutines to exit.
+// The disconnected handler is invoked if a session was active. Close may be called more than once.
+// Close also waits for handlers which are running or queued, so a handler mustn't call it directly,
+// but may call it in a new goroutine.
+func (ibbq *Ibbq) Close() error {
+	var err error
+	ibbq.lifecycle.closeOnce.Do(func() {
+		logger.Debug("Closing")
+		ibbq.lifecycle.mu.Lock()
+		ibbq.lifecycle.closed = true
+		s := ibbq.lifecycle.session
+		ibbq.lifecycle.mu.Unlock()
+		ibbq.lifecycle.cancel()
+		if s != nil {
+			ibbq.updateStatus(Disconnecting)
+			s.client.CancelConnection()
+			err = ibbq.endSession(s)
+		} else {
+			err = ibbq.stopDevice()
+		}
+		ibbq.lifecycle.wg.Wait()
+		ibbq.dispatcher.close()
+		logger.Debug("Closed")
+	})
+	return err
+}
@@ -0,0 +1,232 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// newTestIbbq creates an Ibbq using the fake device, with everything which starts a goroutine switched on.
+func newTestIbbq(t *testing.T, ctx context.Context, d *fakeDevice, mode DispatchMode) (*Ibbq, *int32) {
+	config := DefaultConfiguration
+	config.SharedDevice = &SharedDevice{Device: d}
+	config.ConnectTimeout = 5 * time.Second
+	config.BatteryPollingInterval = 5 * time.Millisecond
+	config.RSSIPollingInterval = 5 * time.Millisecond
+	config.SamplingMode = IntervalSampling
+	config.SamplingInterval = 5 * time.Millisecond
+	config.DispatchMode = mode
+	disconnects := new(int32)
+	bbq, err := NewIbbq(ctx, config, func() { atomic.AddInt32(disconnects, 1) }, func([]float64) {}, func(int) {}, func(Status) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bbq.SetReadingHandler(func(Reading) {})
+	bbq.SetSignalStrengthHandler(func(SignalStrength) {})
+	return &bbq, disconnects
+}
+
+// waitDisconnected fails the test unless the session ends soon.
+func waitDisconnected(t *testing.T, bbq *Ibbq) {
+	select {
+	case <-bbq.Disconnected():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session didn't end")
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(t *testing.T, bbq *Ibbq, d *fakeDevice, cancel context.CancelFunc)
+	}{
+		{"disconnect", func(t *testing.T, bbq *Ibbq, d *fakeDevice, cancel context.CancelFunc) {
+			if err := bbq.Disconnect(false); err != nil {
+				t.Fatal(err)
+			}
+			waitDisconnected(t, bbq)
+		}},
+		{"force disconnect", func(t *testing.T, bbq *Ibbq, d *fakeDevice, cancel context.CancelFunc) {
+			if err := bbq.Disconnect(true); err != nil {
+				t.Fatal(err)
+			}
+			waitDisconnected(t, bbq)
+		}},
+		{"device disconnects", func(t *testing.T, bbq *Ibbq, d *fakeDevice, cancel context.CancelFunc) {
+			d.client().CancelConnection()
+			waitDisconnected(t, bbq)
+		}},
+		{"context cancelled", func(t *testing.T, bbq *Ibbq, d *fakeDevice, cancel context.CancelFunc) {
+			cancel()
+			waitDisconnected(t, bbq)
+		}},
+		{"close", func(t *testing.T, bbq *Ibbq, d *fakeDevice, cancel context.CancelFunc) {}},
+	}
+	for _, mode := range []DispatchMode{ConcurrentDispatch, SerialDispatch} {
+		for _, test := range tests {
+			t.Run(string(mode)+"/"+test.name, func(t *testing.T) {
+				defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				d := &fakeDevice{}
+				bbq, disconnects := newTestIbbq(t, ctx, d, mode)
+				if err := bbq.Connect(); err != nil {
+					t.Fatal(err)
+				}
+				if status := bbq.Status(); status != Connected {
+					t.Fatalf("got status %v, want %v", status, Connected)
+				}
+				// let the sampler, and the battery and RSSI pollers, run for a while
+				time.Sleep(20 * time.Millisecond)
+				test.end(t, bbq, d, cancel)
+				if err := bbq.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if err := bbq.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if status := bbq.Status(); status != Disconnected {
+					t.Errorf("got status %v, want %v", status, Disconnected)
+				}
+				if _, ok := bbq.LastReading(); !ok {
+					t.Error("no reading was received")
+				}
+				if _, ok := bbq.LastBattery(); !ok {
+					t.Error("no battery level was received")
+				}
+				waitFor(t, func() bool { return atomic.LoadInt32(disconnects) == 1 })
+				if d.stops() != 0 {
+					t.Error("the shared device was stopped")
+				}
+				if err := bbq.Connect(); err != ErrClosed {
+					t.Errorf("connecting after closing returned %v, want %v", err, ErrClosed)
+				}
+			})
+		}
+	}
+}
+
+func TestConnectCancelled(t *testing.T) {
+	tests := []struct {
+		name   string
+		device *fakeDevice
+		// timeout, if set, is the connect timeout. Otherwise the context is cancelled.
+		timeout time.Duration
+	}{
+		{"while scanning", &fakeDevice{hideThermometer: true}, 0},
+		{"while dialling", &fakeDevice{blockDial: true}, 0},
+		{"while logging in", &fakeDevice{blockLogin: true}, 0},
+		{"scan timeout", &fakeDevice{hideThermometer: true}, 10 * time.Millisecond},
+		{"login timeout", &fakeDevice{blockLogin: true}, 10 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			d := test.device
+			bbq, disconnects := newTestIbbq(t, ctx, d, SerialDispatch)
+			if test.timeout > 0 {
+				bbq.config.ConnectTimeout = test.timeout
+			} else {
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}
+			if err := bbq.Connect(); err == nil {
+				t.Fatal("connecting succeeded")
+			}
+			if status := bbq.Status(); status != Disconnected {
+				t.Errorf("got status %v, want %v", status, Disconnected)
+			}
+			if err := bbq.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if c := d.client(); c != nil {
+				select {
+				case <-c.Disconnected():
+				default:
+					t.Error("the connection wasn't cancelled")
+				}
+				waitFor(t, func() bool { return atomic.LoadInt32(disconnects) == 1 })
+			}
+		})
+	}
+}
+
+func TestReconnectorCycles(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := &fakeDevice{}
+	r := NewReconnector(func(ctx context.Context) (*Ibbq, error) {
+		bbq, _ := newTestIbbq(t, ctx, d, ConcurrentDispatch)
+		return bbq, nil
+	})
+	r.MinDelay = time.Millisecond
+	done := make(chan error, 1)
+	go func() { done <- r.Run(ctx) }()
+	for i := 1; i <= 3; i++ {
+		waitFor(t, func() bool {
+			bbq := r.Current()
+			return bbq != nil && bbq.Status() == Connected && d.dialled() == i
+		})
+		d.client().CancelConnection()
+	}
+	waitFor(t, func() bool { return r.Reconnects() == 3 })
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("got %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconnector didn't stop")
+	}
+}
+
+func TestKeepDisplayUnits(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprint(keep), func(t *testing.T) {
+			d := &fakeDevice{}
+			bbq, _ := newTestIbbq(t, context.Background(), d, SerialDispatch)
+			bbq.config.KeepDisplayUnits = keep
+			if err := bbq.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			defer bbq.Close()
+			if wrote := d.client().wrote(unitsCelsius); wrote == keep {
+				t.Errorf("got units written %v with KeepDisplayUnits %v", wrote, keep)
+			}
+		})
+	}
+}
+
+// waitFor fails the test unless the condition is met soon.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
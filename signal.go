@@ -0,0 +1,93 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"time"
+)
+
+// SignalStrength is a received signal strength reading for the connection to the device.
+type SignalStrength struct {
+	// Time is when the signal strength was read.
+	Time time.Time
+	// RSSI is the received signal strength, in dBm.
+	RSSI int
+	// Weak is set when the RSSI is below the configured weak signal threshold.
+	Weak bool
+}
+
+// SignalStrengthHandler is a callback for signal strength readings.
+type SignalStrengthHandler func(SignalStrength)
+
+// SetSignalStrengthHandler registers a callback for signal strength readings.
+// It should be called before Connect.
+func (ibbq *Ibbq) SetSignalStrengthHandler(signalStrengthHandler SignalStrengthHandler) {
+	ibbq.signalStrengthHandler = signalStrengthHandler
+}
+
+// LastSignalStrength returns the most recent signal strength reading, if any has been taken.
+func (ibbq *Ibbq) LastSignalStrength() (SignalStrength, bool) {
+	return ibbq.state.lastSignalStrength()
+}
+
+// signalStrengthReceived records a signal strength reading and passes it on.
+func (ibbq *Ibbq) signalStrengthReceived(rssi int) {
+	signalStrength := SignalStrength{
+		Time: time.Now(),
+		RSSI: rssi,
+		Weak: ibbq.config.WeakSignalThreshold != 0 && rssi < ibbq.config.WeakSignalThreshold,
+	}
+	previous, ok := ibbq.state.lastSignalStrength()
+	ibbq.state.setSignalStrength(signalStrength)
+	if signalStrength.Weak && (!ok || !previous.Weak) {
+		logger.Warn("Weak signal", "rssi", rssi, "threshold", ibbq.config.WeakSignalThreshold)
+	} else if !signalStrength.Weak && ok && previous.Weak {
+		logger.Info("Signal recovered", "rssi", rssi)
+	}
+	if ibbq.signalStrengthHandler != nil {
+		ibbq.dispatch(signalStrengthHandlerName, func() { ibbq.signalStrengthHandler(signalStrength) })
+	}
+}
+
+// startSignalStrengthPolling records the RSSI the device advertised with, and starts polling if configured.
+func (ibbq *Ibbq) startSignalStrengthPolling(s *session, advertisedRSSI int) {
+	if advertisedRSSI != 0 {
+		ibbq.signalStrengthReceived(advertisedRSSI)
+	}
+	if ibbq.config.RSSIPollingInterval > 0 {
+		ibbq.goTracked(func() { ibbq.pollSignalStrength(s) })
+	}
+}
+
+// pollSignalStrength periodically reads the RSSI of the connection.
+// Backends which can't read the RSSI of a connection report zero, in which case we give up.
+func (ibbq *Ibbq) pollSignalStrength(s *session) {
+	ticker := time.NewTicker(ibbq.config.RSSIPollingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rssi := s.client.ReadRSSI()
+			if rssi == 0 {
+				logger.Info("Reading RSSI is not supported by this backend")
+				return
+			}
+			ibbq.signalStrengthReceived(rssi)
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWeakSignal(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		rssi      int
+		want      bool
+	}{
+		{"below threshold", -85, -90, true},
+		{"at threshold", -85, -85, false},
+		{"above threshold", -85, -60, false},
+		{"disabled", 0, -90, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfiguration
+			config.SharedDevice = &SharedDevice{Device: &fakeDevice{}}
+			config.WeakSignalThreshold = test.threshold
+			bbq, err := NewIbbq(context.Background(), config, nil, nil, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bbq.signalStrengthReceived(test.rssi)
+			signalStrength, ok := bbq.LastSignalStrength()
+			if !ok {
+				t.Fatal("signal strength wasn't recorded")
+			}
+			if signalStrength.RSSI != test.rssi || signalStrength.Weak != test.want {
+				t.Errorf("got %+v, want RSSI %d and weak %v", signalStrength, test.rssi, test.want)
+			}
+		})
+	}
+}
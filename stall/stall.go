@@ -0,0 +1,237 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package stall detects stalls: the hours-long plateau large cuts of meat go through,
+// typically between 65 and 75 degrees celsius, as evaporation from the surface cools them.
+package stall
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/rate"
+)
+
+// Configuration configures a Detector.
+type Configuration struct {
+	// Probes lists the indexes of the probes to watch. Nil watches every probe.
+	Probes []int
+	// MinTemperature and MaxTemperature bound the band, in celsius, in which stalls are looked for.
+	MinTemperature float64
+	MaxTemperature float64
+	// MaxRate is the rate of rise, in celsius per hour, below which a probe is considered to have stalled.
+	MaxRate float64
+	// ExitRate is the rate of rise, in celsius per hour, above which a stall is considered to have ended.
+	// It should be greater than MaxRate, so that a stall doesn't start and end repeatedly.
+	ExitRate float64
+	// Window is the period over which the rate of rise is measured.
+	Window time.Duration
+	// MinDuration is how long the rate of rise must stay below MaxRate before a stall is reported.
+	MinDuration time.Duration
+	// Suppressor, if set, causes readings to be skipped while it reports them as suppressed,
+	// e.g. while the cooker's lid is open, so that the dip and recovery isn't mistaken for the end of a stall.
+	Suppressor ibbq.Suppressor
+}
+
+// DefaultConfiguration is a somewhat sane default.
+var DefaultConfiguration = Configuration{
+	MinTemperature: 60,
+	MaxTemperature: 80,
+	MaxRate:        2,
+	ExitRate:       4,
+	Window:         10 * time.Minute,
+	MinDuration:    15 * time.Minute,
+}
+
+// EventType distinguishes the start of a stall from its end.
+type EventType string
+
+const (
+	// StallStarted means a probe's temperature has plateaued.
+	StallStarted EventType = "StallStarted"
+	// StallEnded means a probe's temperature has started rising again, or the probe has been unplugged.
+	StallEnded EventType = "StallEnded"
+)
+
+// Event reports the start or end of a stall.
+type Event struct {
+	Type EventType
+	// Probe is the index of the probe.
+	Probe int
+	// Time is when the event was detected.
+	Time time.Time
+	// Temperature is the probe's temperature when the event was detected, in celsius.
+	// It is ibbq.UnpluggedTemperature when a stall ends because the probe was unplugged.
+	Temperature float64
+	// Started is when the stall began, i.e. when the temperature first plateaued.
+	Started time.Time
+	// Duration is how long the stall has lasted.
+	Duration time.Duration
+}
+
+// Handler is a callback for stall events.
+type Handler func(Event)
+
+type probeState struct {
+	flatSince time.Time
+	stalled   bool
+}
+
+// Detector detects stalls from a stream of readings. It is safe for concurrent use.
+type Detector struct {
+	mu      sync.Mutex
+	config  Configuration
+	handler Handler
+	rates   *rate.Calculator
+	probes  map[int]*probeState
+}
+
+// NewDetector creates a detector. The handler, which may be nil, is called with each stall event.
+func NewDetector(config Configuration, handler Handler) *Detector {
+	return &Detector{
+		config:  config,
+		handler: handler,
+		rates:   rate.NewCalculator(rate.Configuration{Window: config.Window}, nil),
+		probes:  map[int]*probeState{},
+	}
+}
+
+// Update feeds a reading to the detector. It is meant to be called from a reading handler.
+func (d *Detector) Update(reading ibbq.Reading) {
+	if d.config.Suppressor != nil && d.config.Suppressor.Suppressed() {
+		return
+	}
+	var events []Event
+	d.mu.Lock()
+	d.rates.Update(reading)
+	for probe, temperature := range reading.Temperatures {
+		if !d.watching(probe) {
+			continue
+		}
+		if !ibbq.ProbeConnected(temperature) {
+			if state, ok := d.probes[probe]; ok && state.stalled {
+				events = append(events, state.end(probe, reading.Time, temperature))
+			}
+			delete(d.probes, probe)
+			continue
+		}
+		if event, ok := d.update(probe, reading.Time, temperature); ok {
+			events = append(events, event)
+		}
+	}
+	handler := d.handler
+	d.mu.Unlock()
+	if handler != nil {
+		for _, event := range events {
+			handler(event)
+		}
+	}
+}
+
+// Stalled reports whether a probe is stalled and, if so, when the stall began.
+func (d *Detector) Stalled(probe int) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state, ok := d.probes[probe]
+	if !ok || !state.stalled {
+		return time.Time{}, false
+	}
+	return state.flatSince, true
+}
+
+// StalledProbes returns the indexes of the probes which are stalled.
+func (d *Detector) StalledProbes() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var probes []int
+	for probe, state := range d.probes {
+		if state.stalled {
+			probes = append(probes, probe)
+		}
+	}
+	sort.Ints(probes)
+	return probes
+}
+
+func (d *Detector) watching(probe int) bool {
+	if d.config.Probes == nil {
+		return true
+	}
+	for _, p := range d.config.Probes {
+		if p == probe {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Detector) update(probe int, t time.Time, temperature float64) (Event, bool) {
+	state, ok := d.probes[probe]
+	if !ok {
+		state = &probeState{}
+		d.probes[probe] = state
+	}
+	ratePerMinute, ok := d.rates.Rate(probe)
+	if !ok {
+		// not enough history to measure the rate of rise yet
+		return Event{}, false
+	}
+	rate := ratePerMinute * 60
+	inBand := temperature >= d.config.MinTemperature && temperature <= d.config.MaxTemperature
+	if state.stalled {
+		if rate > d.config.ExitRate || temperature > d.config.MaxTemperature {
+			return state.end(probe, t, temperature), true
+		}
+		return Event{}, false
+	}
+	if !inBand || rate > d.config.MaxRate {
+		state.flatSince = time.Time{}
+		return Event{}, false
+	}
+	if state.flatSince.IsZero() {
+		// the rate of rise is measured over the window, so the plateau began about halfway through it
+		state.flatSince = t.Add(-d.config.Window / 2)
+	}
+	if t.Sub(state.flatSince) < d.config.MinDuration {
+		return Event{}, false
+	}
+	state.stalled = true
+	return Event{
+		Type:        StallStarted,
+		Probe:       probe,
+		Time:        t,
+		Temperature: temperature,
+		Started:     state.flatSince,
+		Duration:    t.Sub(state.flatSince),
+	}, true
+}
+
+// end ends the probe's stall, returning the StallEnded event.
+func (state *probeState) end(probe int, t time.Time, temperature float64) Event {
+	event := Event{
+		Type:        StallEnded,
+		Probe:       probe,
+		Time:        t,
+		Temperature: temperature,
+		Started:     state.flatSince,
+		Duration:    t.Sub(state.flatSince),
+	}
+	state.stalled = false
+	state.flatSince = time.Time{}
+	return event
+}
@@ -0,0 +1,138 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package stall
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+)
+
+// suppressor reports readings as suppressed while suppressed is set.
+type suppressor struct {
+	suppressed bool
+	unplugged  bool
+}
+
+func (s *suppressor) Suppressed() bool {
+	return s.suppressed
+}
+
+// segment is a stretch of a cook, during which the temperature changes at a constant rate.
+type segment struct {
+	minutes    int
+	perMinute  float64
+	suppressed bool
+	unplugged  bool
+}
+
+// cook feeds a probe's temperatures, from 40 celsius, to the detector once a minute, returning the events.
+func cook(config Configuration, segments []segment) []EventType {
+	var events []EventType
+	lid := &suppressor{}
+	if config.Suppressor == nil {
+		config.Suppressor = lid
+	}
+	d := NewDetector(config, func(e Event) {
+		events = append(events, e.Type)
+	})
+	at := time.Unix(1600000000, 0)
+	temperature := 40.0
+	for _, s := range segments {
+		for i := 0; i < s.minutes; i++ {
+			at = at.Add(time.Minute)
+			temperature += s.perMinute
+			lid.suppressed = s.suppressed
+			probe := temperature
+			if s.unplugged {
+				probe = ibbq.UnpluggedTemperature
+			}
+			d.Update(ibbq.Reading{Time: at, Temperatures: []float64{probe, ibbq.UnpluggedTemperature}})
+		}
+	}
+	return events
+}
+
+func TestDetector(t *testing.T) {
+	rising := segment{minutes: 25, perMinute: 1}
+	tests := []struct {
+		name     string
+		config   func(c *Configuration)
+		segments []segment
+		want     []EventType
+	}{
+		{"no stall", nil, []segment{{minutes: 60, perMinute: 0.5}}, nil},
+		{"too short", nil, []segment{rising, {minutes: 12}, {minutes: 20, perMinute: 1}}, nil},
+		{"stall", nil, []segment{rising, {minutes: 60, perMinute: 0.01}}, []EventType{StallStarted}},
+		{"stall ends", nil, []segment{rising, {minutes: 60}, {minutes: 15, perMinute: 0.5}}, []EventType{StallStarted, StallEnded}},
+		{"leaving the band ends the stall", func(c *Configuration) { c.ExitRate = 100 }, []segment{rising, {minutes: 60}, {minutes: 20, perMinute: 1}}, []EventType{StallStarted, StallEnded}},
+		{"unplugging ends the stall", nil, []segment{rising, {minutes: 60}, {minutes: 5, unplugged: true}}, []EventType{StallStarted, StallEnded}},
+		{"plateau below the band", nil, []segment{{minutes: 10, perMinute: 1}, {minutes: 60}}, nil},
+		{"unwatched probe", func(c *Configuration) { c.Probes = []int{1} }, []segment{rising, {minutes: 60}}, nil},
+		{
+			"lid opened during the stall",
+			nil,
+			[]segment{rising, {minutes: 60}, {minutes: 2, perMinute: -5}, {minutes: 5, perMinute: 2}, {minutes: 30}},
+			[]EventType{StallStarted, StallEnded, StallStarted},
+		},
+		{
+			"suppressed lid opening",
+			nil,
+			[]segment{rising, {minutes: 60}, {minutes: 2, perMinute: -5, suppressed: true}, {minutes: 5, perMinute: 2, suppressed: true}, {minutes: 30}},
+			[]EventType{StallStarted},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfiguration
+			if test.config != nil {
+				test.config(&config)
+			}
+			if got := cook(config, test.segments); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStalled(t *testing.T) {
+	d := NewDetector(DefaultConfiguration, nil)
+	at := time.Unix(1600000000, 0)
+	for i := 0; i < 60; i++ {
+		at = at.Add(time.Minute)
+		d.Update(ibbq.Reading{Time: at, Temperatures: []float64{70, 30, 71}})
+	}
+	if got, want := d.StalledProbes(), []int{0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got stalled probes %v, want %v", got, want)
+	}
+	started, ok := d.Stalled(0)
+	if !ok {
+		t.Fatal("probe 1 isn't stalled")
+	}
+	if first := time.Unix(1600000000, 0); started.Before(first) || at.Sub(started) < DefaultConfiguration.MinDuration {
+		t.Errorf("got stall started at %v, want between %v and %v", started, first, at.Add(-DefaultConfiguration.MinDuration))
+	}
+	if _, ok := d.Stalled(1); ok {
+		t.Error("probe 2 is stalled below the band")
+	}
+	// unplugging a probe ends its stall
+	d.Update(ibbq.Reading{Time: at.Add(time.Minute), Temperatures: []float64{ibbq.UnpluggedTemperature, 30, 71}})
+	if _, ok := d.Stalled(0); ok {
+		t.Error("probe 1 is still stalled after being unplugged")
+	}
+}
@@ -0,0 +1,164 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package ibbq
+
+import (
+	"sync"
+	"time"
+)
+
+// Reading is a set of temperatures received from the device.
+type Reading struct {
+	// Time is when the reading was received.
+	Time time.Time
+	// Temperatures holds one temperature per probe, in celsius, after filtering.
+	Temperatures []float64
+	// Raw holds one temperature per probe, in celsius, as received from the device.
+	Raw []float64
+}
+
+func (r Reading) copy() Reading {
+	r.Temperatures = append([]float64(nil), r.Temperatures...)
+	r.Raw = append([]float64(nil), r.Raw...)
+	return r
+}
+
+// Battery is a battery reading received from the device.
+type Battery struct {
+	// Time is when the reading was received.
+	Time time.Time
+	// Percent is the battery level as a percentage.
+	Percent int
+	// Voltage is the current battery voltage, in millivolts.
+	Voltage int
+	// MaxVoltage is the voltage of a full battery, in millivolts.
+	MaxVoltage int
+	// SamplingMode is the sampling mode in effect when the reading was received.
+	SamplingMode SamplingMode
+	// RealTimeDuty is the fraction of the time since the previous battery reading, or since connecting,
+	// for which the device was sending real-time data. Sampling modes other than continuous lower it to save battery.
+	RealTimeDuty float64
+}
+
+// state holds the latest values received from the device.
+type state struct {
+	mu             sync.RWMutex
+	status         Status
+	address        string
+	reading        *Reading
+	battery        *Battery
+	signalStrength *SignalStrength
+	batteryWaiters []chan Battery
+}
+
+func newState() *state {
+	return &state{status: Disconnected}
+}
+
+func (s *state) setStatus(status Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *state) getStatus() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+func (s *state) setAddress(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.address = address
+}
+
+func (s *state) getAddress() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.address
+}
+
+func (s *state) setReading(reading Reading) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reading = reading.copy()
+	s.reading = &reading
+}
+
+func (s *state) lastReading() (Reading, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.reading == nil {
+		return Reading{}, false
+	}
+	return s.reading.copy(), true
+}
+
+// setBattery records a battery reading and passes it to anyone waiting for one.
+func (s *state) setBattery(battery Battery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.battery = &battery
+	for _, waiter := range s.batteryWaiters {
+		waiter <- battery
+	}
+	s.batteryWaiters = nil
+}
+
+func (s *state) lastBattery() (Battery, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.battery == nil {
+		return Battery{}, false
+	}
+	return *s.battery, true
+}
+
+// awaitBattery returns a channel which receives the next battery reading.
+func (s *state) awaitBattery() chan Battery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	waiter := make(chan Battery, 1)
+	s.batteryWaiters = append(s.batteryWaiters, waiter)
+	return waiter
+}
+
+func (s *state) cancelBatteryWait(waiter chan Battery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.batteryWaiters {
+		if w == waiter {
+			s.batteryWaiters = append(s.batteryWaiters[:i], s.batteryWaiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *state) setSignalStrength(signalStrength SignalStrength) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signalStrength = &signalStrength
+}
+
+func (s *state) lastSignalStrength() (SignalStrength, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.signalStrength == nil {
+		return SignalStrength{}, false
+	}
+	return *s.signalStrength, true
+}
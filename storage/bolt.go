@@ -0,0 +1,420 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	readingsBucket = []byte("readings")
+	batteryBucket  = []byte("battery")
+	statusBucket   = []byte("status")
+	sessionsBucket = []byte("sessions")
+)
+
+var errCorrupt = errors.New("corrupt record")
+
+// BoltStore is a Store kept in a single bbolt database file.
+// Readings, battery levels and status changes are kept in a bucket per device, keyed by time.
+// Concurrent writes, e.g. from several devices' handlers, are batched into a single transaction.
+type BoltStore struct {
+	db     *bolt.DB
+	config Configuration
+}
+
+var _ Store = (*BoltStore)(nil)
+
+// OpenBolt opens, or creates, a store in the given file.
+func OpenBolt(path string, config Configuration) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{readingsBucket, batteryBucket, statusBucket, sessionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db, config: config}, nil
+}
+
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+func encodeTemperatures(temperatures []float64) []byte {
+	value := make([]byte, 8*len(temperatures))
+	for i, t := range temperatures {
+		binary.BigEndian.PutUint64(value[8*i:], math.Float64bits(t))
+	}
+	return value
+}
+
+func decodeTemperatures(value []byte) ([]float64, error) {
+	if len(value)%8 != 0 {
+		return nil, errCorrupt
+	}
+	temperatures := make([]float64, len(value)/8)
+	for i := range temperatures {
+		temperatures[i] = math.Float64frombits(binary.BigEndian.Uint64(value[8*i:]))
+	}
+	return temperatures, nil
+}
+
+// put stores a record, batching it with any others being put at the same time,
+// rather than paying for a transaction, and a sync to disk, per record.
+func (s *BoltStore) put(bucket []byte, device string, t time.Time, value []byte) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(bucket).CreateBucketIfNotExists([]byte(device))
+		if err != nil {
+			return err
+		}
+		return b.Put(timeKey(t), value)
+	})
+}
+
+// AddReading stores a reading from a device.
+func (s *BoltStore) AddReading(device string, reading ibbq.Reading) error {
+	return s.put(readingsBucket, device, reading.Time, encodeTemperatures(reading.Temperatures))
+}
+
+// AddBattery stores a battery reading from a device.
+func (s *BoltStore) AddBattery(device string, battery ibbq.Battery) error {
+	return s.put(batteryBucket, device, battery.Time, encodeBattery(battery))
+}
+
+// encodeBattery encodes the percentage, voltages and real-time duty as fixed-size fields, followed by the sampling mode.
+func encodeBattery(battery ibbq.Battery) []byte {
+	value := make([]byte, 20, 20+len(battery.SamplingMode))
+	binary.BigEndian.PutUint32(value, uint32(battery.Percent))
+	binary.BigEndian.PutUint32(value[4:], uint32(battery.Voltage))
+	binary.BigEndian.PutUint32(value[8:], uint32(battery.MaxVoltage))
+	binary.BigEndian.PutUint64(value[12:], math.Float64bits(battery.RealTimeDuty))
+	return append(value, battery.SamplingMode...)
+}
+
+// decodeBattery decodes a battery reading.
+func decodeBattery(t time.Time, value []byte) (ibbq.Battery, error) {
+	if len(value) < 20 {
+		return ibbq.Battery{}, errCorrupt
+	}
+	return ibbq.Battery{
+		Time:         t,
+		Percent:      int(binary.BigEndian.Uint32(value)),
+		Voltage:      int(binary.BigEndian.Uint32(value[4:])),
+		MaxVoltage:   int(binary.BigEndian.Uint32(value[8:])),
+		RealTimeDuty: math.Float64frombits(binary.BigEndian.Uint64(value[12:])),
+		SamplingMode: ibbq.SamplingMode(value[20:]),
+	}, nil
+}
+
+// AddStatus stores a device's connection status changing.
+func (s *BoltStore) AddStatus(device string, t time.Time, status ibbq.Status) error {
+	return s.put(statusBucket, device, t, []byte(status))
+}
+
+// SaveSession stores a cook session, replacing any with the same ID.
+func (s *BoltStore) SaveSession(session SessionRecord) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put([]byte(session.ID), value)
+	})
+}
+
+// Session returns the cook session with the given ID, or ErrNotFound.
+func (s *BoltStore) Session(id string) (SessionRecord, error) {
+	var session SessionRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(sessionsBucket).Get([]byte(id))
+		if value == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(value, &session)
+	})
+	return session, err
+}
+
+// Sessions returns a device's cook sessions, or every session if device is empty, in order of starting.
+func (s *BoltStore) Sessions(device string) ([]SessionRecord, error) {
+	var sessions []SessionRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			var session SessionRecord
+			if err := json.Unmarshal(v, &session); err != nil {
+				return err
+			}
+			if device == "" || session.Device == device {
+				sessions = append(sessions, session)
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Started.Before(sessions[j].Started)
+	})
+	return sessions, err
+}
+
+// Devices returns the devices which have stored readings.
+func (s *BoltStore) Devices() ([]string, error) {
+	var devices []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(readingsBucket).ForEach(func(k, v []byte) error {
+			devices = append(devices, string(k))
+			return nil
+		})
+	})
+	return devices, err
+}
+
+// scan calls f with each record in the query's time range, for each of the query's devices, in time order.
+// f returns false to stop scanning.
+func (s *BoltStore) scan(bucket []byte, query Query, f func(device string, t time.Time, value []byte) (bool, error)) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		type cursor struct {
+			device string
+			c      *bolt.Cursor
+			k, v   []byte
+		}
+		var cursors []*cursor
+		var start []byte
+		if !query.From.IsZero() {
+			start = timeKey(query.From)
+		}
+		err := tx.Bucket(bucket).ForEach(func(name, _ []byte) error {
+			if query.Device != "" && query.Device != string(name) {
+				return nil
+			}
+			c := &cursor{device: string(name), c: tx.Bucket(bucket).Bucket(name).Cursor()}
+			if start == nil {
+				c.k, c.v = c.c.First()
+			} else {
+				c.k, c.v = c.c.Seek(start)
+			}
+			cursors = append(cursors, c)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		var end []byte
+		if !query.To.IsZero() {
+			end = timeKey(query.To)
+		}
+		// merge the devices' records into time order
+		for {
+			var next *cursor
+			for _, c := range cursors {
+				if c.k == nil || (end != nil && bytes.Compare(c.k, end) > 0) {
+					continue
+				}
+				if next == nil || bytes.Compare(c.k, next.k) < 0 {
+					next = c
+				}
+			}
+			if next == nil {
+				return nil
+			}
+			more, err := f(next.device, keyTime(next.k), next.v)
+			if err != nil || !more {
+				return err
+			}
+			next.k, next.v = next.c.Next()
+		}
+	})
+}
+
+// Readings returns the samples selected by the query, in time order. Unplugged probes are left out.
+func (s *BoltStore) Readings(query Query) ([]Sample, error) {
+	var samples []Sample
+	err := s.scan(readingsBucket, query, func(device string, t time.Time, value []byte) (bool, error) {
+		temperatures, err := decodeTemperatures(value)
+		if err != nil {
+			return false, err
+		}
+		for probe, temperature := range temperatures {
+			if !query.selectsProbe(probe) || !ibbq.ProbeConnected(temperature) {
+				continue
+			}
+			samples = append(samples, Sample{Device: device, Probe: probe, Time: t, Temperature: temperature})
+			if query.Limit > 0 && len(samples) >= query.Limit {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	return samples, err
+}
+
+// Batteries returns the battery readings selected by the query, in time order.
+func (s *BoltStore) Batteries(query Query) ([]BatteryRecord, error) {
+	var records []BatteryRecord
+	err := s.scan(batteryBucket, query, func(device string, t time.Time, value []byte) (bool, error) {
+		battery, err := decodeBattery(t, value)
+		if err != nil {
+			return false, err
+		}
+		records = append(records, BatteryRecord{Device: device, Battery: battery})
+		return query.Limit <= 0 || len(records) < query.Limit, nil
+	})
+	return records, err
+}
+
+// Statuses returns the status changes selected by the query, in time order.
+func (s *BoltStore) Statuses(query Query) ([]StatusChange, error) {
+	var changes []StatusChange
+	err := s.scan(statusBucket, query, func(device string, t time.Time, value []byte) (bool, error) {
+		changes = append(changes, StatusChange{Device: device, Time: t, Status: ibbq.Status(value)})
+		return query.Limit <= 0 || len(changes) < query.Limit, nil
+	})
+	return changes, err
+}
+
+// Compact deletes data older than the retention period, and averages readings older than the downsampling age
+// over the downsampling interval. Sessions are kept regardless.
+func (s *BoltStore) Compact(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{readingsBucket, batteryBucket, statusBucket} {
+			var devices [][]byte
+			err := tx.Bucket(bucket).ForEach(func(name, _ []byte) error {
+				devices = append(devices, name)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, device := range devices {
+				b := tx.Bucket(bucket).Bucket(device)
+				if s.config.Retention > 0 {
+					if err = expire(b, now.Add(-s.config.Retention)); err != nil {
+						return err
+					}
+				}
+				if bytes.Equal(bucket, readingsBucket) && s.config.DownsampleAfter > 0 && s.config.DownsampleInterval > 0 {
+					if err = downsample(b, now.Add(-s.config.DownsampleAfter), s.config.DownsampleInterval); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// expire deletes records before the cutoff.
+func expire(b *bolt.Bucket, cutoff time.Time) error {
+	end := timeKey(cutoff)
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downsample replaces the readings in each interval before the cutoff with their average,
+// taken at the start of the interval. Intervals holding a single reading are left alone.
+func downsample(b *bolt.Bucket, cutoff time.Time, interval time.Duration) error {
+	end := timeKey(cutoff.Truncate(interval))
+	type group struct {
+		start time.Time
+		keys  [][]byte
+		sums  []float64
+		count []int
+	}
+	var groups []*group
+	var current *group
+	c := b.Cursor()
+	for k, v := c.First(); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+		temperatures, err := decodeTemperatures(v)
+		if err != nil {
+			return err
+		}
+		start := keyTime(k).Truncate(interval)
+		if current == nil || !current.start.Equal(start) {
+			current = &group{start: start}
+			groups = append(groups, current)
+		}
+		current.keys = append(current.keys, k)
+		for len(current.sums) < len(temperatures) {
+			current.sums = append(current.sums, 0)
+			current.count = append(current.count, 0)
+		}
+		for probe, t := range temperatures {
+			if ibbq.ProbeConnected(t) {
+				current.sums[probe] += t
+				current.count[probe]++
+			}
+		}
+	}
+	for _, g := range groups {
+		if len(g.keys) < 2 {
+			continue
+		}
+		for _, k := range g.keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		average := make([]float64, len(g.sums))
+		for probe := range average {
+			average[probe] = ibbq.UnpluggedTemperature
+			if g.count[probe] > 0 {
+				average[probe] = g.sums[probe] / float64(g.count[probe])
+			}
+		}
+		if err := b.Put(timeKey(g.start), encodeTemperatures(average)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,260 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sworisbreathing/go-ibbq/v2"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestStore(t *testing.T, config Configuration) (*BoltStore, func()) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenBolt(filepath.Join(dir, "ibbq.db"), config)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+var epoch = time.Unix(1600000000, 0)
+
+func TestReadings(t *testing.T) {
+	store, cleanup := openTestStore(t, DefaultConfiguration)
+	defer cleanup()
+	for i := 0; i < 3; i++ {
+		at := epoch.Add(time.Duration(i) * time.Second)
+		if err := store.AddReading("a", ibbq.Reading{Time: at, Temperatures: []float64{100 + float64(i), ibbq.UnpluggedTemperature}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddReading("b", ibbq.Reading{Time: at.Add(time.Millisecond), Temperatures: []float64{50, 60}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name  string
+		query Query
+		want  []Sample
+	}{
+		{"device", Query{Device: "a"}, []Sample{
+			{"a", 0, epoch, 100}, {"a", 0, epoch.Add(time.Second), 101}, {"a", 0, epoch.Add(2 * time.Second), 102},
+		}},
+		{"devices in time order", Query{To: epoch.Add(time.Second)}, []Sample{
+			{"a", 0, epoch, 100}, {"b", 0, epoch.Add(time.Millisecond), 50}, {"b", 1, epoch.Add(time.Millisecond), 60}, {"a", 0, epoch.Add(time.Second), 101},
+		}},
+		{"probe and range", Query{Device: "b", Probes: []int{1}, From: epoch.Add(time.Second)}, []Sample{
+			{"b", 1, epoch.Add(time.Second + time.Millisecond), 60}, {"b", 1, epoch.Add(2*time.Second + time.Millisecond), 60},
+		}},
+		{"limit", Query{Limit: 2}, []Sample{{"a", 0, epoch, 100}, {"b", 0, epoch.Add(time.Millisecond), 50}}},
+		{"unknown device", Query{Device: "c"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := store.Readings(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i].Time = got[i].Time.In(epoch.Location())
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConcurrentWritesAreBatched(t *testing.T) {
+	store, cleanup := openTestStore(t, DefaultConfiguration)
+	defer cleanup()
+	const writers, readings = 10, 20
+	before := store.db.Stats().TxStats.Write
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < readings; i++ {
+				at := epoch.Add(time.Duration(i)*time.Second + time.Duration(w))
+				if err := store.AddReading("a", ibbq.Reading{Time: at, Temperatures: []float64{float64(w)}}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	samples, err := store.Readings(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != writers*readings {
+		t.Errorf("got %d samples, want %d", len(samples), writers*readings)
+	}
+	if transactions := store.db.Stats().TxStats.Write - before; transactions >= writers*readings {
+		t.Errorf("got %d write transactions for %d readings", transactions, writers*readings)
+	}
+}
+
+func TestBatteries(t *testing.T) {
+	store, cleanup := openTestStore(t, DefaultConfiguration)
+	defer cleanup()
+	battery := ibbq.Battery{
+		Time:         epoch,
+		Percent:      85,
+		Voltage:      3570,
+		MaxVoltage:   4200,
+		SamplingMode: ibbq.AdaptiveSampling,
+		RealTimeDuty: 0.25,
+	}
+	storage := RecordBattery(store, "a")
+	storage(battery)
+	records, err := store.Batteries(Query{Device: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d battery readings, want 1", len(records))
+	}
+	records[0].Battery.Time = records[0].Battery.Time.In(epoch.Location())
+	if records[0].Battery != battery {
+		t.Errorf("got %+v, want %+v", records[0].Battery, battery)
+	}
+	// a reading without the duty and sampling mode is corrupt
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(batteryBucket).Bucket([]byte("a")).Put(timeKey(epoch.Add(time.Minute)), encodeBattery(battery)[:12])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Batteries(Query{Device: "a"}); err != errCorrupt {
+		t.Errorf("got error %v reading a truncated battery reading, want %v", err, errCorrupt)
+	}
+}
+
+func TestDecodeBattery(t *testing.T) {
+	battery := ibbq.Battery{Time: epoch, Percent: 85, Voltage: 3570, MaxVoltage: 4200, RealTimeDuty: 0.25}
+	tests := []struct {
+		name    string
+		value   []byte
+		want    ibbq.Battery
+		wantErr error
+	}{
+		{"empty", nil, ibbq.Battery{}, errCorrupt},
+		{"without duty", encodeBattery(battery)[:12], ibbq.Battery{}, errCorrupt},
+		{"truncated duty", encodeBattery(battery)[:19], ibbq.Battery{}, errCorrupt},
+		{"without sampling mode", encodeBattery(battery), battery, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := decodeBattery(epoch, test.value)
+			if err != test.wantErr {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStatusesAndSessions(t *testing.T) {
+	store, cleanup := openTestStore(t, DefaultConfiguration)
+	defer cleanup()
+	for i, status := range []ibbq.Status{ibbq.Connecting, ibbq.Connected, ibbq.Disconnected} {
+		if err := store.AddStatus("a", epoch.Add(time.Duration(i)*time.Second), status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err := store.Statuses(Query{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Status != ibbq.Connecting || changes[1].Status != ibbq.Connected {
+		t.Errorf("got %+v", changes)
+	}
+	for _, session := range []SessionRecord{
+		{ID: "2", Device: "a", Started: epoch.Add(time.Hour)},
+		{ID: "1", Device: "a", Started: epoch},
+		{ID: "3", Device: "b", Started: epoch},
+	} {
+		if err = store.SaveSession(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sessions, err := store.Sessions("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "1" || sessions[1].ID != "2" {
+		t.Errorf("got %+v", sessions)
+	}
+	if _, err = store.Session("4"); err != ErrNotFound {
+		t.Errorf("got %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	config := Configuration{Retention: time.Hour, DownsampleAfter: 10 * time.Minute, DownsampleInterval: time.Minute}
+	store, cleanup := openTestStore(t, config)
+	defer cleanup()
+	now := epoch.Add(2 * time.Hour)
+	add := func(at time.Time, temperatures ...float64) {
+		if err := store.AddReading("a", ibbq.Reading{Time: at, Temperatures: temperatures}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// expired
+	add(now.Add(-90*time.Minute), 10)
+	// averaged into one reading
+	old := now.Add(-30 * time.Minute).Truncate(time.Minute)
+	add(old, 100, ibbq.UnpluggedTemperature)
+	add(old.Add(20*time.Second), 102, 50)
+	// recent, so kept as is
+	add(now.Add(-time.Minute), 110, 60)
+	add(now.Add(-time.Minute+time.Second), 111, 61)
+	if err := store.Compact(now); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := store.Readings(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Sample{
+		{"a", 0, old, 101}, {"a", 1, old, 50},
+		{"a", 0, now.Add(-time.Minute), 110}, {"a", 1, now.Add(-time.Minute), 60},
+		{"a", 0, now.Add(-time.Minute + time.Second), 111}, {"a", 1, now.Add(-time.Minute + time.Second), 61},
+	}
+	for i := range samples {
+		samples[i].Time = samples[i].Time.In(epoch.Location())
+	}
+	if !reflect.DeepEqual(samples, want) {
+		t.Errorf("got %v, want %v", samples, want)
+	}
+}
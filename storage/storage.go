@@ -0,0 +1,176 @@
+/*
+   Copyright 2018 the original author or authors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package storage persists readings, battery levels, status transitions and cook sessions,
+// with retention and downsampling of old data.
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mgutz/logxi/v1"
+	"github.com/sworisbreathing/go-ibbq/v2"
+	"github.com/sworisbreathing/go-ibbq/v2/cook"
+)
+
+var logger = log.New("storage")
+
+// ErrNotFound is returned when a session is not in the store.
+var ErrNotFound = errors.New("not found")
+
+// Sample is one probe's temperature at a point in time.
+type Sample struct {
+	Device      string    `json:"device"`
+	Probe       int       `json:"probe"`
+	Time        time.Time `json:"time"`
+	Temperature float64   `json:"temperature"`
+}
+
+// BatteryRecord is a battery reading from a device.
+type BatteryRecord struct {
+	Device  string       `json:"device"`
+	Battery ibbq.Battery `json:"battery"`
+}
+
+// StatusChange is a device's connection status changing.
+type StatusChange struct {
+	Device string      `json:"device"`
+	Time   time.Time   `json:"time"`
+	Status ibbq.Status `json:"status"`
+}
+
+// SessionRecord is the stored form of a cook session. Its readings are stored separately,
+// and can be queried by the session's device and time range.
+type SessionRecord struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name,omitempty"`
+	Device      string            `json:"device,omitempty"`
+	Started     time.Time         `json:"started"`
+	Stopped     time.Time         `json:"stopped"`
+	Metadata    cook.Metadata     `json:"metadata"`
+	Annotations []cook.Annotation `json:"annotations,omitempty"`
+}
+
+// SessionRecordFor describes a cook session taking place on a device.
+func SessionRecordFor(device string, session *cook.Session) SessionRecord {
+	return SessionRecord{
+		ID:          session.ID(),
+		Name:        session.Name(),
+		Device:      device,
+		Started:     session.Started(),
+		Stopped:     session.Stopped(),
+		Metadata:    session.Metadata(),
+		Annotations: session.Annotations(),
+	}
+}
+
+// Query selects stored data.
+type Query struct {
+	// Device selects a device's data. If empty, every device's data is selected.
+	Device string
+	// Probes selects probes by index. If empty, every probe is selected. It only applies to readings.
+	Probes []int
+	// From and To bound the time range, inclusively. Zero times leave the range open.
+	From time.Time
+	To   time.Time
+	// Limit, if set, is the most results to return.
+	Limit int
+}
+
+func (q Query) selectsProbe(probe int) bool {
+	if len(q.Probes) == 0 {
+		return true
+	}
+	for _, p := range q.Probes {
+		if p == probe {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists data from devices.
+type Store interface {
+	// AddReading stores a reading from a device.
+	AddReading(device string, reading ibbq.Reading) error
+	// AddBattery stores a battery reading from a device.
+	AddBattery(device string, battery ibbq.Battery) error
+	// AddStatus stores a device's connection status changing.
+	AddStatus(device string, t time.Time, status ibbq.Status) error
+	// SaveSession stores a cook session, replacing any with the same ID.
+	SaveSession(session SessionRecord) error
+	// Session returns the cook session with the given ID, or ErrNotFound.
+	Session(id string) (SessionRecord, error)
+	// Sessions returns a device's cook sessions, or every session if device is empty, in order of starting.
+	Sessions(device string) ([]SessionRecord, error)
+	// Devices returns the devices which have stored readings.
+	Devices() ([]string, error)
+	// Readings returns the samples selected by the query, in time order. Unplugged probes are left out.
+	Readings(query Query) ([]Sample, error)
+	// Batteries returns the battery readings selected by the query, in time order.
+	Batteries(query Query) ([]BatteryRecord, error)
+	// Statuses returns the status changes selected by the query, in time order.
+	Statuses(query Query) ([]StatusChange, error)
+	// Compact applies the store's retention and downsampling policies as of the given time.
+	Compact(now time.Time) error
+	// Close closes the store.
+	Close() error
+}
+
+// Configuration configures a store's retention and downsampling policies.
+type Configuration struct {
+	// Retention is how long data is kept. Zero keeps data forever.
+	Retention time.Duration
+	// DownsampleAfter is the age after which readings are downsampled. Zero disables downsampling.
+	DownsampleAfter time.Duration
+	// DownsampleInterval is the period over which downsampled readings are averaged.
+	DownsampleInterval time.Duration
+}
+
+// DefaultConfiguration is a somewhat sane default.
+var DefaultConfiguration = Configuration{
+	Retention:          90 * 24 * time.Hour,
+	DownsampleAfter:    7 * 24 * time.Hour,
+	DownsampleInterval: time.Minute,
+}
+
+// RecordReadings returns a reading handler which stores each reading from the device.
+func RecordReadings(store Store, device string) ibbq.ReadingHandler {
+	return func(reading ibbq.Reading) {
+		if err := store.AddReading(device, reading); err != nil {
+			logger.Error("Error storing reading", "device", device, "err", err)
+		}
+	}
+}
+
+// RecordBattery returns a battery handler which stores each battery reading from the device, including its voltage.
+func RecordBattery(store Store, device string) ibbq.BatteryHandler {
+	return func(battery ibbq.Battery) {
+		if err := store.AddBattery(device, battery); err != nil {
+			logger.Error("Error storing battery level", "device", device, "err", err)
+		}
+	}
+}
+
+// RecordStatus returns a status handler which stores each status change of the device.
+func RecordStatus(store Store, device string) ibbq.StatusUpdatedHandler {
+	return func(status ibbq.Status) {
+		if err := store.AddStatus(device, time.Now(), status); err != nil {
+			logger.Error("Error storing status", "device", device, "err", err)
+		}
+	}
+}